@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+)
+
+const (
+	AuthNone   = "none"
+	AuthAPIKey = "api-key"
+	AuthHMAC   = "hmac"
+	AuthJWT    = "jwt"
+
+	APIKeyHeader        = "X-Api-Key"
+	CallerHeader        = "X-Caller"
+	SignatureHeader     = "X-Signature"
+	TimestampHeader     = "X-Signature-Timestamp"
+	DefaultMaxClockSkew = 5 * time.Minute
+
+	// AdminCaller is the caller of the requests with the admin API key, no other caller can have its name
+	AdminCaller = "admin"
+
+	maxSignedBodyBytes = 1 << 20
+)
+
+var unauthenticatedError = errors.New("missing credentials")
+
+// authenticator identifies the caller of a request.
+type authenticator interface {
+	authenticate(request *http.Request) (string, error)
+}
+
+type callerKey struct{}
+
+// requireCaller rejects the requests the authenticator can't identify, and passes the caller on to the handler in the request context.
+// Every request is let through without an authenticator.
+func requireCaller(auth authenticator, next http.HandlerFunc) http.HandlerFunc {
+	if auth == nil {
+		return next
+	}
+	return func(writer http.ResponseWriter, request *http.Request) {
+		caller, err := auth.authenticate(request)
+		if err != nil {
+			logger.WithTransactionID(request.Header.Get("X-Request-Id")).WithError(err).Warnf("Unauthenticated request to %v from %v", request.URL.Path, request.RemoteAddr)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(writer, request.WithContext(context.WithValue(request.Context(), callerKey{}, caller)))
+	}
+}
+
+// requireAdmin lets through the requests of the AdminCaller only. It expects the caller in the request context, from requireCaller.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if callerOf(request) != AdminCaller {
+			logger.WithTransactionID(request.Header.Get("X-Request-Id")).Warnf("Unauthorized request to %v from %v", request.URL.Path, request.RemoteAddr)
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(writer, request)
+	}
+}
+
+// callerOf returns the authenticated caller of the request, empty when the request wasn't authenticated.
+func callerOf(request *http.Request) string {
+	caller, _ := request.Context().Value(callerKey{}).(string)
+	return caller
+}
+
+// Caller is a client of the service, identified by its key or signing its requests with it.
+type Caller struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// loadCallers reads the JSON array of the callers at path.
+func loadCallers(path string) ([]Caller, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the callers: %v", err)
+	}
+	var callers []Caller
+	if err := json.Unmarshal(b, &callers); err != nil {
+		return nil, fmt.Errorf("could not parse the callers: %v", err)
+	}
+	names := map[string]bool{}
+	keys := map[string]bool{}
+	for _, c := range callers {
+		if c.Name == "" || names[c.Name] {
+			return nil, fmt.Errorf("caller names must be set and unique, found %q", c.Name)
+		}
+		if c.Name == AdminCaller {
+			return nil, fmt.Errorf("the caller name %q is reserved for the admin API key", AdminCaller)
+		}
+		if c.Key == "" || keys[c.Key] {
+			return nil, fmt.Errorf("caller keys must be set and unique, found a missing or duplicated key for %v", c.Name)
+		}
+		names[c.Name] = true
+		keys[c.Key] = true
+	}
+	return callers, nil
+}
+
+// newAuthenticator returns nil for AuthNone, so that requests are let through.
+func newAuthenticator(mode string, callersFile string, jwksFile string, issuer string, audience string, maxClockSkew time.Duration) (authenticator, error) {
+	switch mode {
+	case AuthNone:
+		return nil, nil
+	case AuthAPIKey, AuthHMAC:
+		callers, err := loadCallers(callersFile)
+		if err != nil {
+			return nil, err
+		}
+		if mode == AuthAPIKey {
+			return &apiKeyAuthenticator{callers: callers}, nil
+		}
+		return newHMACAuthenticator(callers, maxClockSkew), nil
+	case AuthJWT:
+		keys, err := loadJWKS(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		return &jwtAuthenticator{keys: keys, issuer: issuer, audience: audience, leeway: maxClockSkew, now: time.Now}, nil
+	}
+	return nil, fmt.Errorf("unknown auth mode %q, expected %v, %v, %v or %v", mode, AuthNone, AuthAPIKey, AuthHMAC, AuthJWT)
+}
+
+// withAdminKey identifies the requests with the admin API key as a bearer token as the AdminCaller, and the others with auth.
+// Without auth, the other requests are let through without a caller. It returns auth when there is no admin API key.
+func withAdminKey(adminAPIKey string, auth authenticator) authenticator {
+	if adminAPIKey == "" {
+		return auth
+	}
+	return &adminKeyAuthenticator{key: adminAPIKey, callers: auth}
+}
+
+type adminKeyAuthenticator struct {
+	key     string
+	callers authenticator
+}
+
+func (a *adminKeyAuthenticator) authenticate(request *http.Request) (string, error) {
+	header := request.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") && subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(a.key)) == 1 {
+		return AdminCaller, nil
+	}
+	if a.callers == nil {
+		return "", nil
+	}
+	return a.callers.authenticate(request)
+}
+
+// apiKeyAuthenticator identifies the callers by the key in the X-Api-Key header.
+type apiKeyAuthenticator struct {
+	callers []Caller
+}
+
+func (a *apiKeyAuthenticator) authenticate(request *http.Request) (string, error) {
+	key := request.Header.Get(APIKeyHeader)
+	if key == "" {
+		return "", unauthenticatedError
+	}
+	for _, c := range a.callers {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(c.Key)) == 1 {
+			return c.Name, nil
+		}
+	}
+	return "", errors.New("unknown API key")
+}
+
+// hmacAuthenticator checks the signature of the requests, made with the key of the caller named in the X-Caller header.
+// Requests signed more than maxClockSkew ago, or ahead, are rejected, so that they can't be replayed later on.
+type hmacAuthenticator struct {
+	keys         map[string]string
+	maxClockSkew time.Duration
+	now          func() time.Time
+}
+
+func newHMACAuthenticator(callers []Caller, maxClockSkew time.Duration) *hmacAuthenticator {
+	keys := make(map[string]string, len(callers))
+	for _, c := range callers {
+		keys[c.Name] = c.Key
+	}
+	return &hmacAuthenticator{keys: keys, maxClockSkew: maxClockSkew, now: time.Now}
+}
+
+func (a *hmacAuthenticator) authenticate(request *http.Request) (string, error) {
+	caller := request.Header.Get(CallerHeader)
+	timestamp := request.Header.Get(TimestampHeader)
+	signature := request.Header.Get(SignatureHeader)
+	if caller == "" || timestamp == "" || signature == "" {
+		return "", unauthenticatedError
+	}
+	key, ok := a.keys[caller]
+	if !ok {
+		return "", fmt.Errorf("unknown caller %v", caller)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid signature timestamp %q", timestamp)
+	}
+	if skew := a.now().Sub(time.Unix(seconds, 0)); skew > a.maxClockSkew || skew < -a.maxClockSkew {
+		return "", fmt.Errorf("signature timestamp %v is too far from the current time", timestamp)
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, request.Body, maxSignedBodyBytes))
+	if err != nil {
+		return "", fmt.Errorf("could not read the signed body: %v", err)
+	}
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	expected := requestSignature(key, timestamp, request.Method, request.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", fmt.Errorf("invalid signature from %v", caller)
+	}
+	return caller, nil
+}
+
+// requestSignature is the HMAC-SHA256 of the timestamp, the method, the request URI and the body, joined by dots.
+func requestSignature(key string, timestamp string, method string, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + "." + method + "." + requestURI + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
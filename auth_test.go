@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireCaller_APIKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "callers.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"name":"reindexer","key":"some-key"}]`), 0644))
+
+	auth, err := newAuthenticator(AuthAPIKey, path, "", "", "", DefaultMaxClockSkew)
+	assert.NoError(t, err)
+	var caller string
+	handler := requireCaller(auth, func(writer http.ResponseWriter, request *http.Request) {
+		caller = callerOf(request)
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", nil)
+	req.Header.Set(APIKeyHeader, "other-key")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, caller)
+
+	req = httptest.NewRequest("POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", nil)
+	req.Header.Set(APIKeyHeader, "some-key")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "reindexer", caller)
+}
+
+func TestRequireCaller_WithoutAuthenticator(t *testing.T) {
+	auth, err := newAuthenticator(AuthNone, "", "", "", "", DefaultMaxClockSkew)
+	assert.NoError(t, err)
+	called := false
+	w := httptest.NewRecorder()
+	requireCaller(auth, func(writer http.ResponseWriter, request *http.Request) {
+		called = true
+		assert.Empty(t, callerOf(request))
+	})(w, httptest.NewRequest("POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", nil))
+	assert.True(t, called)
+
+	_, err = newAuthenticator("basic", "", "", "", "", DefaultMaxClockSkew)
+	assert.Error(t, err)
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	now := time.Date(2017, 3, 30, 13, 9, 6, 0, time.UTC)
+	auth := newHMACAuthenticator([]Caller{{Name: "reindexer", Key: "some-key"}}, DefaultMaxClockSkew)
+	auth.now = func() time.Time { return now }
+
+	signed := func(key string, signedAt time.Time, body string) *http.Request {
+		req := httptest.NewRequest("POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", strings.NewReader(body))
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		req.Header.Set(CallerHeader, "reindexer")
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, requestSignature(key, timestamp, "POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", []byte(body)))
+		return req
+	}
+
+	req := signed("some-key", now.Add(-time.Minute), "some body")
+	caller, err := auth.authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "reindexer", caller)
+	body, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "some body", string(body))
+
+	_, err = auth.authenticate(signed("other-key", now, ""))
+	assert.Error(t, err)
+
+	_, err = auth.authenticate(signed("some-key", now.Add(-10*time.Minute), ""))
+	assert.Error(t, err)
+
+	req = signed("some-key", now, "some body")
+	req.URL.Path = "/other"
+	_, err = auth.authenticate(req)
+	assert.Error(t, err)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"rsa-key","n":"%s","e":"%s"},{"kty":"EC","kid":"ec-key","crv":"P-256","x":"%s","y":"%s"}]}`,
+		encodeBigInt(rsaKey.N), encodeBigInt(big.NewInt(int64(rsaKey.E))), encodeBigInt(ecKey.X), encodeBigInt(ecKey.Y))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(jwks), 0644))
+
+	a, err := newAuthenticator(AuthJWT, "", path, "https://issuer.ft.com", "post-publication-combiner", DefaultMaxClockSkew)
+	assert.NoError(t, err)
+	auth := a.(*jwtAuthenticator)
+	now := time.Date(2017, 3, 30, 13, 9, 6, 0, time.UTC)
+	auth.now = func() time.Time { return now }
+
+	claims := map[string]interface{}{"sub": "reindexer", "iss": "https://issuer.ft.com", "aud": []string{"post-publication-combiner"}, "exp": now.Add(time.Hour).Unix()}
+	authenticate := func(token string) (string, error) {
+		req := httptest.NewRequest("POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return auth.authenticate(req)
+	}
+
+	caller, err := authenticate(signToken(t, "RS256", "rsa-key", rsaKey, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, "reindexer", caller)
+
+	caller, err = authenticate(signToken(t, "ES256", "ec-key", ecKey, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, "reindexer", caller)
+
+	// the algorithm must match the key
+	_, err = authenticate(signToken(t, "ES256", "rsa-key", ecKey, claims))
+	assert.Error(t, err)
+
+	_, err = authenticate(signToken(t, "RS256", "unknown-key", rsaKey, claims))
+	assert.Error(t, err)
+
+	expired := map[string]interface{}{"sub": "reindexer", "iss": "https://issuer.ft.com", "aud": "post-publication-combiner", "exp": now.Add(-time.Hour).Unix()}
+	_, err = authenticate(signToken(t, "RS256", "rsa-key", rsaKey, expired))
+	assert.Error(t, err)
+
+	otherIssuer := map[string]interface{}{"sub": "reindexer", "iss": "https://other.ft.com", "aud": "post-publication-combiner", "exp": now.Add(time.Hour).Unix()}
+	_, err = authenticate(signToken(t, "RS256", "rsa-key", rsaKey, otherIssuer))
+	assert.Error(t, err)
+
+	admin := map[string]interface{}{"sub": AdminCaller, "iss": "https://issuer.ft.com", "aud": "post-publication-combiner", "exp": now.Add(time.Hour).Unix()}
+	_, err = authenticate(signToken(t, "RS256", "rsa-key", rsaKey, admin))
+	assert.Error(t, err, "the admin caller is reserved for the admin API key")
+
+	token := signToken(t, "RS256", "rsa-key", rsaKey, claims)
+	parts := strings.Split(token, ".")
+	tampered, err := json.Marshal(map[string]interface{}{"sub": "admin", "iss": "https://issuer.ft.com", "aud": "post-publication-combiner", "exp": now.Add(time.Hour).Unix()})
+	assert.NoError(t, err)
+	_, err = authenticate(parts[0] + "." + base64.RawURLEncoding.EncodeToString(tampered) + "." + parts[2])
+	assert.Error(t, err)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func signToken(t *testing.T, alg string, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	assert.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestWithAdminKey(t *testing.T) {
+	assert.Nil(t, withAdminKey("", nil))
+
+	var caller string
+	handler := requireCaller(withAdminKey("admin-key", nil), func(writer http.ResponseWriter, request *http.Request) {
+		caller = callerOf(request)
+	})
+
+	req := httptest.NewRequest("GET", "/__config", nil)
+	req.Header.Set("Authorization", "Bearer admin-key")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, AdminCaller, caller)
+
+	req = httptest.NewRequest("GET", "/__config", nil)
+	req.Header.Set("Authorization", "Bearer other-key")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "other requests are let through without a caller authenticator")
+	assert.Empty(t, caller)
+
+	handler = requireCaller(withAdminKey("admin-key", &apiKeyAuthenticator{callers: []Caller{{Name: "reindexer", Key: "some-key"}}}), func(writer http.ResponseWriter, request *http.Request) {
+		caller = callerOf(request)
+	})
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest("GET", "/__config", nil)
+	req.Header.Set(APIKeyHeader, "some-key")
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "reindexer", caller)
+}
+
+func TestRequireAdmin(t *testing.T) {
+	handler := requireCaller(&apiKeyAuthenticator{callers: []Caller{{Name: "reindexer", Key: "some-key"}}}, requireAdmin(func(writer http.ResponseWriter, request *http.Request) {}))
+	req := httptest.NewRequest("PUT", "/__whitelists", nil)
+	req.Header.Set(APIKeyHeader, "some-key")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	w = httptest.NewRecorder()
+	adminOnly(func(writer http.ResponseWriter, request *http.Request) {})(w, adminRequest("PUT", "/__whitelists"))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLoadCallers_ReservesTheAdminCaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "callers.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"name":"admin","key":"some-key"}]`), 0644))
+
+	_, err = loadCallers(path)
+	assert.Error(t, err)
+}
+
+// adminOnly routes the handler for the requests with the "some-key" admin API key only.
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return requireCaller(withAdminKey("some-key", nil), requireAdmin(next))
+}
+
+func adminRequest(method string, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer some-key")
+	return req
+}
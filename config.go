@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	cli "github.com/jawher/mow.cli"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	uuidPlaceholder = "{uuid}"
+	redacted        = "REDACTED"
+)
+
+// settings declares the options of the app, taking their defaults from the config file, so that env vars and flags still override them.
+// It keeps the declared options, to validate them once parsed and to show the effective configuration.
+type settings struct {
+	app     *cli.Cli
+	file    map[string]interface{}
+	path    string
+	options []*option
+	errs    []string
+}
+
+type option struct {
+	name     string
+	envVar   string
+	secret   bool
+	value    interface{}
+	validate func() error
+}
+
+// newSettings reads the YAML or TOML config file at path, the file is optional when path is empty.
+func newSettings(app *cli.Cli, path string) (*settings, error) {
+	s := &settings{app: app, file: map[string]interface{}{}, path: path}
+	if path == "" {
+		return s, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the config file: %v", err)
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &s.file)
+	case ".toml":
+		_, err = toml.Decode(string(b), &s.file)
+	default:
+		return nil, fmt.Errorf("unsupported config file %v, expected a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the config file %v: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *settings) String(opt cli.StringOpt, validators ...func(string) error) *string {
+	if v, ok := s.fromFile(opt.Name); ok {
+		if str, ok := v.(string); ok {
+			opt.Value = str
+		} else {
+			s.invalid(opt.Name, "must be a string")
+		}
+	}
+	p := s.app.String(opt)
+	s.add(opt.Name, opt.EnvVar, opt.HideValue, p, func() error {
+		for _, validate := range validators {
+			if err := validate(*p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return p
+}
+
+func (s *settings) Strings(opt cli.StringsOpt, validators ...func([]string) error) *[]string {
+	if v, ok := s.fromFile(opt.Name); ok {
+		if l, ok := toStrings(v); ok {
+			opt.Value = l
+		} else {
+			s.invalid(opt.Name, "must be a list of strings")
+		}
+	}
+	p := s.app.Strings(opt)
+	s.add(opt.Name, opt.EnvVar, opt.HideValue, p, func() error {
+		for _, validate := range validators {
+			if err := validate(*p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return p
+}
+
+func (s *settings) Int(opt cli.IntOpt, validators ...func(int) error) *int {
+	if v, ok := s.fromFile(opt.Name); ok {
+		switch i := v.(type) {
+		case int:
+			opt.Value = i
+		case int64:
+			opt.Value = int(i)
+		default:
+			s.invalid(opt.Name, "must be an integer")
+		}
+	}
+	p := s.app.Int(opt)
+	s.add(opt.Name, opt.EnvVar, opt.HideValue, p, func() error {
+		for _, validate := range validators {
+			if err := validate(*p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return p
+}
+
+func (s *settings) Bool(opt cli.BoolOpt) *bool {
+	if v, ok := s.fromFile(opt.Name); ok {
+		if b, ok := v.(bool); ok {
+			opt.Value = b
+		} else {
+			s.invalid(opt.Name, "must be a boolean")
+		}
+	}
+	p := s.app.Bool(opt)
+	s.add(opt.Name, opt.EnvVar, opt.HideValue, p, nil)
+	return p
+}
+
+// fromFile returns the value of the setting in the config file, removing it so that only the unknown settings are left.
+func (s *settings) fromFile(name string) (interface{}, bool) {
+	v, ok := s.file[name]
+	delete(s.file, name)
+	return v, ok
+}
+
+func (s *settings) add(name string, envVar string, secret bool, value interface{}, validate func() error) {
+	s.options = append(s.options, &option{name: name, envVar: envVar, secret: secret, value: value, validate: validate})
+}
+
+func (s *settings) invalid(name string, reason string) {
+	s.errs = append(s.errs, fmt.Sprintf("%v %v", name, reason))
+}
+
+// FileErr reports the settings of the config file that are unknown or of the wrong type, once all the options are declared.
+func (s *settings) FileErr() error {
+	errs := append([]string{}, s.errs...)
+	var unknown []string
+	for name := range s.file {
+		unknown = append(unknown, name)
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, fmt.Sprintf("unknown setting %v", name))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config file %v: %v", s.path, strings.Join(errs, "; "))
+}
+
+// Validate checks the parsed options, and reports all the invalid ones at once.
+func (s *settings) Validate() error {
+	var errs []string
+	for _, o := range s.options {
+		if o.validate == nil {
+			continue
+		}
+		if err := o.validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("%v (%v): %v", o.name, o.envVar, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration: %v", strings.Join(errs, "; "))
+}
+
+// Effective returns the value of every option, with the secrets and the credentials in URLs redacted.
+func (s *settings) Effective() map[string]interface{} {
+	effective := make(map[string]interface{}, len(s.options))
+	for _, o := range s.options {
+		switch v := o.value.(type) {
+		case *string:
+			if o.secret && *v != "" {
+				effective[o.name] = redacted
+				continue
+			}
+			effective[o.name] = redactCredentials(*v)
+		case *[]string:
+			l := make([]string, 0, len(*v))
+			for _, e := range *v {
+				l = append(l, redactCredentials(e))
+			}
+			effective[o.name] = l
+		case *int:
+			effective[o.name] = *v
+		case *bool:
+			effective[o.name] = *v
+		}
+	}
+	return effective
+}
+
+func redactCredentials(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = url.User(redacted)
+	return u.String()
+}
+
+func toStrings(v interface{}) ([]string, bool) {
+	l, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, 0, len(l))
+	for _, e := range l {
+		str, ok := e.(string)
+		if !ok {
+			return nil, false
+		}
+		strs = append(strs, str)
+	}
+	return strs, true
+}
+
+func validURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expected an http or https URL, got %q", value)
+	}
+	return nil
+}
+
+func withUUIDPlaceholder(value string) error {
+	if !strings.Contains(value, uuidPlaceholder) {
+		return fmt.Errorf("expected the %v placeholder in %q", uuidPlaceholder, value)
+	}
+	return nil
+}
+
+func notEmpty(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("must not be empty")
+	}
+	return nil
+}
+
+func notNegative(value int) error {
+	if value < 0 {
+		return fmt.Errorf("must not be negative, got %d", value)
+	}
+	return nil
+}
+
+// withoutEmptyValues rejects lists with empty values, which usually come from stray commas in env vars.
+func withoutEmptyValues(values []string) error {
+	if len(values) == 0 {
+		return errors.New("must not be empty")
+	}
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("must not have empty values, got %q", values)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/gorilla/mux"
+)
+
+const consumerPathVar = "consumer"
+
+// pausableConsumer is a consumer the admin endpoints can pause, e.g. during the maintenance of a dependency.
+type pausableConsumer interface {
+	Pause()
+	Resume()
+	Paused() bool
+	Topic() string
+}
+
+type consumerState struct {
+	Topic  string `json:"topic"`
+	Paused bool   `json:"paused"`
+}
+
+type consumersHandler struct {
+	consumers map[string]pausableConsumer
+}
+
+func (handler *consumersHandler) getConsumers(writer http.ResponseWriter, request *http.Request) {
+	handler.writeStates(writer)
+}
+
+func (handler *consumersHandler) pause(writer http.ResponseWriter, request *http.Request) {
+	handler.update(writer, request, pausableConsumer.Pause)
+}
+
+func (handler *consumersHandler) resume(writer http.ResponseWriter, request *http.Request) {
+	handler.update(writer, request, pausableConsumer.Resume)
+}
+
+func (handler *consumersHandler) update(writer http.ResponseWriter, request *http.Request, action func(pausableConsumer)) {
+	name := mux.Vars(request)[consumerPathVar]
+	c, ok := handler.consumers[name]
+	if !ok {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	action(c)
+	logger.WithTransactionID(request.Header.Get("X-Request-Id")).Infof("Consumer %v of %v is now paused: %v", name, c.Topic(), c.Paused())
+	handler.writeStates(writer)
+}
+
+func (handler *consumersHandler) writeStates(writer http.ResponseWriter) {
+	states := make(map[string]consumerState, len(handler.consumers))
+	for name, c := range handler.consumers {
+		states[name] = consumerState{Topic: c.Topic(), Paused: c.Paused()}
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(states); err != nil {
+		logger.WithError(err).Error("Could not write the consumers state")
+	}
+}
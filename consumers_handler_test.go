@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type dummyPausableConsumer struct {
+	topic  string
+	paused bool
+}
+
+func (c *dummyPausableConsumer) Pause() {
+	c.paused = true
+}
+
+func (c *dummyPausableConsumer) Resume() {
+	c.paused = false
+}
+
+func (c *dummyPausableConsumer) Paused() bool {
+	return c.paused
+}
+
+func (c *dummyPausableConsumer) Topic() string {
+	return c.topic
+}
+
+func TestPauseAndResumeConsumers(t *testing.T) {
+	content := &dummyPausableConsumer{topic: "PostPublicationEvents"}
+	metadata := &dummyPausableConsumer{topic: "PostConceptAnnotations"}
+	ch := consumersHandler{consumers: map[string]pausableConsumer{"content": content, "metadata": metadata}}
+	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/__consumers", ch.getConsumers).Methods("GET")
+	servicesRouter.HandleFunc("/__consumers/{consumer}/pause", adminOnly(ch.pause)).Methods("POST")
+	servicesRouter.HandleFunc("/__consumers/{consumer}/resume", adminOnly(ch.resume)).Methods("POST")
+
+	w := httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, httptest.NewRequest("POST", "/__consumers/content/pause", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, content.paused)
+
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, adminRequest("POST", "/__consumers/content/pause"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"content":{"topic":"PostPublicationEvents","paused":true},"metadata":{"topic":"PostConceptAnnotations","paused":false}}`, w.Body.String())
+	assert.True(t, content.paused)
+	assert.False(t, metadata.paused)
+
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, httptest.NewRequest("GET", "/__consumers", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"content":{"topic":"PostPublicationEvents","paused":true},"metadata":{"topic":"PostConceptAnnotations","paused":false}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, adminRequest("POST", "/__consumers/content/resume"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, content.paused)
+
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, adminRequest("POST", "/__consumers/unknown/pause"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
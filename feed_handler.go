@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+)
+
+const (
+	feedViewFull      = "full"
+	feedViewSummary   = "summary"
+	feedKeepAliveTime = 15 * time.Second
+)
+
+type feedHandler struct {
+	feed *processor.LiveFeed
+}
+
+// stream sends the forwarded messages as server-sent events, until the client disconnects.
+// The type, uuid and origin query parameters filter the messages, and view=full sends the whole combined messages instead of their summary.
+func (handler *feedHandler) stream(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	query := request.URL.Query()
+	view := query.Get("view")
+	if view != "" && view != feedViewFull && view != feedViewSummary {
+		http.Error(writer, fmt.Sprintf("invalid view %q, expected summary or full", view), http.StatusBadRequest)
+		return
+	}
+	filter := processor.FeedFilter{Types: query["type"], UUIDs: query["uuid"], Origins: query["origin"]}
+
+	sub := handler.feed.Subscribe(filter, view == feedViewFull)
+	defer func() {
+		handler.feed.Unsubscribe(sub)
+		if dropped := handler.feed.Dropped(sub); dropped > 0 {
+			logger.Warnf("Live feed client %v missed %d messages", request.RemoteAddr, dropped)
+		}
+	}()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(feedKeepAliveTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e := <-sub.Events:
+			b, err := json.Marshal(e)
+			if err != nil {
+				logger.WithTransactionID(e.TID).WithError(err).Error("Could not marshal the live feed event")
+				continue
+			}
+			if _, err := fmt.Fprintf(writer, "event: combined\ndata: %s\n\n", b); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
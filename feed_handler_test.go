@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedStream(t *testing.T) {
+	feed := processor.NewLiveFeed()
+	server := httptest.NewServer(http.HandlerFunc((&feedHandler{feed: feed}).stream))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/__feed?type=Article")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	feed.Publish("CombinedPostPublicationEvents", map[string]string{"X-Request-Id": "some-tid1"}, &processor.CombinedModel{UUID: "video_uuid", Content: processor.ContentModel{"type": "Video"}})
+	feed.Publish("CombinedPostPublicationEvents", map[string]string{"X-Request-Id": "some-tid2"}, &processor.CombinedModel{UUID: "article_uuid", Content: processor.ContentModel{"type": "Article"}})
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: combined\n", line)
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, "data: "))
+	assert.JSONEq(t, `{"uuid":"article_uuid","type":"Article","markedDeleted":"","tid":"some-tid2","topic":"CombinedPostPublicationEvents"}`, strings.TrimPrefix(line, "data: "))
+}
+
+func TestFeedStream_InvalidView(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&feedHandler{feed: processor.NewLiveFeed()}).stream(w, httptest.NewRequest("GET", "/__feed?view=other", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
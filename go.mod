@@ -1,8 +1,9 @@
 module github.com/Financial-Times/post-publication-combiner/v2
 
-go 1.14
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/Financial-Times/go-fthealth v0.0.0-20180807113633-3d8eb430d5b5
 	github.com/Financial-Times/go-logger v0.0.0-20180323124113-febee6537e90
 	github.com/Financial-Times/http-handlers-go v0.0.0-20170809121007-229ac16f1d9e
@@ -17,14 +18,19 @@ require (
 	github.com/gorilla/mux v1.4.1-0.20170830053917-a659b61323b0
 	github.com/hashicorp/go-version v1.0.0 // indirect
 	github.com/jawher/mow.cli v1.0.4
+	github.com/klauspost/compress v1.13.6
+	github.com/linkedin/goavro/v2 v2.12.0
 	github.com/onsi/ginkgo v1.12.0 // indirect
 	github.com/onsi/gomega v1.9.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rcrowley/go-metrics v0.0.0-20161128210544-1f30fe9094a5
 	github.com/satori/go.uuid v1.2.1-0.20181016170032-d91630c85102
 	github.com/sirupsen/logrus v1.0.4-0.20170822132746-89742aefa4b2 // indirect
-	github.com/stretchr/testify v1.2.2
+	github.com/stretchr/testify v1.7.5
+	github.com/xeipuuv/gojsonschema v1.2.0
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793 // indirect
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
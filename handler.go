@@ -1,7 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/post-publication-combiner/v2/processor"
@@ -29,7 +33,7 @@ func (handler *requestHandler) postMessage(writer http.ResponseWriter, request *
 		return
 	}
 
-	err := handler.requestProcessor.ForceMessagePublish(uuid, transactionID)
+	err := handler.requestProcessor.ForceMessagePublish(uuid, transactionID, callerOf(request))
 	switch err {
 	case nil:
 		writer.WriteHeader(http.StatusOK)
@@ -37,13 +41,72 @@ func (handler *requestHandler) postMessage(writer http.ResponseWriter, request *
 		writer.WriteHeader(http.StatusNotFound)
 	case processor.InvalidContentTypeError:
 		writer.WriteHeader(http.StatusUnprocessableEntity)
+	case processor.StaleContentError:
+		writer.WriteHeader(http.StatusConflict)
+	case processor.StaleReadError:
+		writer.WriteHeader(http.StatusServiceUnavailable)
 	default:
+		if errors.Is(err, processor.MessageTooLargeError) {
+			writer.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		var limited *processor.RateLimitError
+		if errors.As(err, &limited) {
+			// Retry-After is in whole seconds, rounded up so that the retry isn't limited again
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			writer.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
 		writer.WriteHeader(http.StatusInternalServerError)
 	}
 
 }
 
+type webhooksHandler struct {
+	webhooks *processor.Webhooks
+}
+
+func (handler *webhooksHandler) getStatus(writer http.ResponseWriter, request *http.Request) {
+	statuses := []processor.SubscriberStatus{}
+	if handler.webhooks != nil {
+		statuses = handler.webhooks.Status()
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(statuses); err != nil {
+		logger.WithError(err).Error("Could not write the webhooks status")
+	}
+}
+
+type historyHandler struct {
+	history *processor.History
+}
+
+func (handler *historyHandler) getHistory(writer http.ResponseWriter, request *http.Request) {
+	uuid := mux.Vars(request)[idPathVar]
+	if !isValidUUID(uuid) {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(handler.history.ForUUID(uuid)); err != nil {
+		logger.WithError(err).Error("Could not write the processing history")
+	}
+}
+
 func isValidUUID(id string) bool {
 	_, err := uuid.FromString(id)
 	return err == nil
 }
+
+type configHandler struct {
+	settings *settings
+}
+
+// getConfig shows the effective configuration, with the secrets redacted.
+func (handler *configHandler) getConfig(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(handler.settings.Effective()); err != nil {
+		logger.WithError(err).Error("Could not write the configuration")
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/post-publication-combiner/v2/processor"
 	"github.com/gorilla/mux"
+	cli "github.com/jawher/mow.cli"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,6 +29,10 @@ func TestPostMessage(t *testing.T) {
 		{"a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "tid_1", errors.New("test error"), 500},
 		{"a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "tid_1", processor.NotFoundError, 404},
 		{"a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "tid_1", processor.InvalidContentTypeError, 422},
+		{"a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "tid_1", processor.StaleContentError, 409},
+		{"a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "tid_1", processor.StaleReadError, 503},
+		{"a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "tid_1", fmt.Errorf("%w: 2048 bytes", processor.MessageTooLargeError), 413},
+		{"a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "tid_1", &processor.RateLimitError{Limit: processor.LimitGlobal, RetryAfter: 1500 * time.Millisecond}, 429},
 	}
 
 	dummyRequestProcessor := &DummyRequestProcessor{t: t}
@@ -55,18 +62,118 @@ func TestPostMessage(t *testing.T) {
 		resp.Body.Close()
 
 		assert.Equal(t, testCase.status, resp.StatusCode)
+		if testCase.status == http.StatusTooManyRequests {
+			assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestPostMessageWithCaller(t *testing.T) {
+	dummyRequestProcessor := &DummyRequestProcessor{t: t, uuid: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88", tid: "tid_1", caller: "reindexer"}
+	rh := requestHandler{requestProcessor: dummyRequestProcessor}
+	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/{id}", requireCaller(&apiKeyAuthenticator{callers: []Caller{{Name: "reindexer", Key: "some-key"}}}, rh.postMessage)).Methods("POST")
+
+	req := httptest.NewRequest("POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", nil)
+	req.Header.Set("X-Request-Id", "tid_1")
+	req.Header.Set(APIKeyHeader, "some-key")
+	w := httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRouterRequiresCallers(t *testing.T) {
+	history, err := processor.NewHistory(10, "")
+	assert.NoError(t, err)
+	whitelists, err := processor.NewWhitelists(processor.Whitelist{ContentURIs: []string{"wordpress-article-mapper"}, Origins: []string{"http://cmdb.ft.com/systems/pac"}, ContentTypes: []string{"Article"}}, "")
+	assert.NoError(t, err)
+	settings, err := newSettings(cli.App("test", ""), "")
+	assert.NoError(t, err)
+	auth := withAdminKey("admin-key", &apiKeyAuthenticator{callers: []Caller{{Name: "reindexer", Key: "some-key"}}})
+	router := newRouter(&requestHandler{}, auth, &webhooksHandler{}, &feedHandler{}, &historyHandler{history: history}, &consumersHandler{consumers: map[string]pausableConsumer{}}, &whitelistsHandler{whitelists: whitelists}, &configHandler{settings: settings}, &HealthcheckHandler{producer: &mockProducer{isConnectionHealthy: true}, consumer: &mockConsumer{isConnectionHealthy: true}})
+
+	tests := []struct {
+		method string
+		path   string
+		header string
+		value  string
+		status int
+	}{
+		{"GET", "/__ping", "", "", http.StatusOK},
+		{"GET", "/__build-info", "", "", http.StatusOK},
+		{"POST", "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "", "", http.StatusUnauthorized},
+		{"GET", "/__history/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", "", "", http.StatusUnauthorized},
+		{"GET", "/__history/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", APIKeyHeader, "some-key", http.StatusOK},
+		{"GET", "/__consumers", APIKeyHeader, "other-key", http.StatusUnauthorized},
+		{"GET", "/__consumers", APIKeyHeader, "some-key", http.StatusOK},
+		{"GET", "/__config", "", "", http.StatusUnauthorized},
+		{"GET", "/__config", "Authorization", "Bearer admin-key", http.StatusOK},
+		{"GET", "/__webhooks", "", "", http.StatusUnauthorized},
+		{"GET", "/__webhooks", APIKeyHeader, "some-key", http.StatusOK},
+		{"GET", "/__feed", "", "", http.StatusUnauthorized},
+		{"GET", "/__whitelists", APIKeyHeader, "some-key", http.StatusUnauthorized},
+		{"GET", "/__whitelists", "Authorization", "Bearer admin-key", http.StatusOK},
+		{"POST", "/__consumers/content/pause", APIKeyHeader, "some-key", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, test.status, w.Code, "%v %v", test.method, test.path)
 	}
 }
 
 type DummyRequestProcessor struct {
-	t    *testing.T
-	uuid string
-	tid  string
-	err  error
+	t      *testing.T
+	uuid   string
+	tid    string
+	caller string
+	err    error
 }
 
-func (p *DummyRequestProcessor) ForceMessagePublish(uuid, tid string) error {
+func (p *DummyRequestProcessor) ForceMessagePublish(uuid, tid string, caller string) error {
 	assert.Equal(p.t, p.uuid, uuid)
 	assert.Equal(p.t, p.tid, tid)
+	assert.Equal(p.t, p.caller, caller)
 	return p.err
 }
+
+func TestGetWebhooksStatus(t *testing.T) {
+	rh := webhooksHandler{}
+	w := httptest.NewRecorder()
+	rh.getStatus(w, httptest.NewRequest("GET", "/__webhooks", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	rh = webhooksHandler{webhooks: processor.NewWebhooks([]processor.Subscriber{{Name: "search", URL: "http://localhost/hook"}}, http.DefaultClient)}
+	w = httptest.NewRecorder()
+	rh.getStatus(w, httptest.NewRequest("GET", "/__webhooks", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"name":"search","url":"http://localhost/hook","delivered":0,"failed":0,"dropped":0,"pending":0}]`, w.Body.String())
+}
+
+func TestGetHistory(t *testing.T) {
+	history, err := processor.NewHistory(10, "")
+	assert.NoError(t, err)
+	rh := historyHandler{history: history}
+	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/__history/{id}", rh.getHistory).Methods("GET")
+	server := httptest.NewServer(servicesRouter)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/__history/invalid")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/__history/a78cf3ea-b221-46f8-8cbc-a61e5e454e88")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(body))
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	health "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/message-queue-go-producer/producer"
@@ -15,16 +19,20 @@ const (
 )
 
 type HealthcheckHandler struct {
-	httpClient                  utils.Client
+	docStoreAPIClient           utils.Client
+	publicAnnotationsAPIClient  utils.Client
 	producer                    producer.MessageProducer
 	consumer                    consumer.MessageConsumer
 	docStoreAPIBaseURL          string
 	publicAnnotationsAPIBaseURL string
+	// pausable are the consumers reported when paused
+	pausable map[string]pausableConsumer
 }
 
-func NewCombinerHealthcheck(p producer.MessageProducer, c consumer.MessageConsumer, client utils.Client, docStoreAPIURL string, publicAnnotationsAPIURL string) *HealthcheckHandler {
+func NewCombinerHealthcheck(p producer.MessageProducer, c consumer.MessageConsumer, docStoreAPIClient utils.Client, docStoreAPIURL string, publicAnnotationsAPIClient utils.Client, publicAnnotationsAPIURL string) *HealthcheckHandler {
 	return &HealthcheckHandler{
-		httpClient:                  client,
+		docStoreAPIClient:           docStoreAPIClient,
+		publicAnnotationsAPIClient:  publicAnnotationsAPIClient,
 		producer:                    p,
 		consumer:                    c,
 		docStoreAPIBaseURL:          docStoreAPIURL,
@@ -54,6 +62,17 @@ func checkKafkaProxyConsumerConnectivity(h *HealthcheckHandler) health.Check {
 	}
 }
 
+func checkConsumersNotPaused(h *HealthcheckHandler) health.Check {
+	return health.Check{
+		BusinessImpact:   "PostPublicationEvents and PostMetadataPublicationEvents messages are not processed while their consumer is paused. Indexing for search is delayed.",
+		Name:             "Check that the consumers are not paused",
+		PanicGuide:       "https://runbooks.in.ft.com/post-publication-combiner",
+		Severity:         3,
+		TechnicalSummary: "A consumer was paused through the admin endpoints, e.g. during the maintenance of a dependency. Resume it with POST /__consumers/{consumer}/resume once it's over.",
+		Checker:          h.checkConsumersNotPaused,
+	}
+}
+
 func checkDocumentStoreAPIHealthcheck(h *HealthcheckHandler) health.Check {
 	return health.Check{
 		BusinessImpact:   "CombinedPostPublication messages can't be constructed. Indexing for content search won't work.",
@@ -105,8 +124,22 @@ func gtgCheck(handler func() (string, error)) gtg.Status {
 	return gtg.Status{GoodToGo: true}
 }
 
+func (h *HealthcheckHandler) checkConsumersNotPaused() (string, error) {
+	var paused []string
+	for name, c := range h.pausable {
+		if c.Paused() {
+			paused = append(paused, name)
+		}
+	}
+	if len(paused) > 0 {
+		sort.Strings(paused)
+		return "", fmt.Errorf("paused consumers: %v", strings.Join(paused, ", "))
+	}
+	return "No consumer is paused", nil
+}
+
 func (h *HealthcheckHandler) checkIfDocumentStoreIsReachable() (string, error) {
-	_, _, err := utils.ExecuteSimpleHTTPRequest(h.docStoreAPIBaseURL+GTGEndpoint, h.httpClient)
+	_, _, err := utils.ExecuteSimpleHTTPRequest(h.docStoreAPIBaseURL+GTGEndpoint, h.docStoreAPIClient)
 	if err != nil {
 		logger.WithError(err).Errorf("Healthcheck error: %v", err.Error())
 		return "", err
@@ -115,7 +148,7 @@ func (h *HealthcheckHandler) checkIfDocumentStoreIsReachable() (string, error) {
 }
 
 func (h *HealthcheckHandler) checkIfPublicAnnotationsAPIIsReachable() (string, error) {
-	_, _, err := utils.ExecuteSimpleHTTPRequest(h.publicAnnotationsAPIBaseURL+GTGEndpoint, h.httpClient)
+	_, _, err := utils.ExecuteSimpleHTTPRequest(h.publicAnnotationsAPIBaseURL+GTGEndpoint, h.publicAnnotationsAPIClient)
 	if err != nil {
 		logger.WithError(err).Errorf("Healthcheck error: %v", err.Error())
 		return "", err
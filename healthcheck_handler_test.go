@@ -27,7 +27,7 @@ func TestCheckIfDocumentStoreIsReachable_Errors(t *testing.T) {
 	}
 	h := HealthcheckHandler{
 		docStoreAPIBaseURL: "doc-store-base-url",
-		httpClient:         &dc,
+		docStoreAPIClient:  &dc,
 	}
 
 	resp, err := h.checkIfDocumentStoreIsReachable()
@@ -42,7 +42,7 @@ func TestCheckIfDocumentStoreIsReachable_Succeeds(t *testing.T) {
 	}
 	h := HealthcheckHandler{
 		docStoreAPIBaseURL: "doc-store-base-url",
-		httpClient:         &dc,
+		docStoreAPIClient:  &dc,
 	}
 
 	resp, err := h.checkIfDocumentStoreIsReachable()
@@ -57,7 +57,7 @@ func TestCheckIfPublicAnnotationsApiIsReachable_Errors(t *testing.T) {
 	}
 	h := HealthcheckHandler{
 		publicAnnotationsAPIBaseURL: "pub-ann-base-url",
-		httpClient:                  &dc,
+		publicAnnotationsAPIClient:  &dc,
 	}
 
 	resp, err := h.checkIfPublicAnnotationsAPIIsReachable()
@@ -72,7 +72,7 @@ func TestCheckIfPublicAnnotationsApiIsReachable_Succeeds(t *testing.T) {
 	}
 	h := HealthcheckHandler{
 		publicAnnotationsAPIBaseURL: "pub-ann-base-url",
-		httpClient:                  &dc,
+		publicAnnotationsAPIClient:  &dc,
 	}
 
 	resp, err := h.checkIfPublicAnnotationsAPIIsReachable()
@@ -87,7 +87,8 @@ func TestAllHealthChecks(t *testing.T) {
 	}
 	h := HealthcheckHandler{
 		publicAnnotationsAPIBaseURL: "pub-ann-base-url",
-		httpClient:                  &dc,
+		docStoreAPIClient:           &dc,
+		publicAnnotationsAPIClient:  &dc,
 		producer:                    &mockProducer{isConnectionHealthy: true},
 		consumer:                    &mockConsumer{isConnectionHealthy: true},
 	}
@@ -137,7 +138,8 @@ func TestGTG_Good(t *testing.T) {
 		statusCode: http.StatusOK,
 	}
 	h := HealthcheckHandler{
-		httpClient:                  &dc,
+		docStoreAPIClient:           &dc,
+		publicAnnotationsAPIClient:  &dc,
 		producer:                    &mockProducer{isConnectionHealthy: true},
 		consumer:                    &mockConsumer{isConnectionHealthy: true},
 		docStoreAPIBaseURL:          "doc-store-base-url",
@@ -191,7 +193,7 @@ func TestGTG_Bad(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			server := getMockedServer(tc.docStoreAPIStatus, tc.pubAnnAPIStatus)
 			defer server.Close()
-			h := NewCombinerHealthcheck(tc.producer, tc.consumer, http.DefaultClient, server.URL+DocStoreAPIPath,
+			h := NewCombinerHealthcheck(tc.producer, tc.consumer, http.DefaultClient, server.URL+DocStoreAPIPath, http.DefaultClient,
 				server.URL+PublicAnnotationsAPIPath)
 
 			status := h.GTG()
@@ -259,3 +261,18 @@ func (p *mockConsumer) ConnectivityCheck() (string, error) {
 
 	return "", errors.New("error connecting to the queue")
 }
+
+func TestCheckConsumersNotPaused(t *testing.T) {
+	content := &dummyPausableConsumer{topic: "PostPublicationEvents"}
+	metadata := &dummyPausableConsumer{topic: "PostConceptAnnotations"}
+	h := HealthcheckHandler{pausable: map[string]pausableConsumer{"content": content, "metadata": metadata}}
+
+	_, err := h.checkConsumersNotPaused()
+	assert.NoError(t, err)
+
+	metadata.paused = true
+	content.paused = true
+	_, err = h.checkConsumersNotPaused()
+	assert.EqualError(t, err, "paused consumers: content, metadata")
+	assert.Equal(t, uint8(3), checkConsumersNotPaused(&h).Severity)
+}
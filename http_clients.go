@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+)
+
+// clientOptions configure the HTTP client of a dependency.
+// Every dependency has its own client, and so its own connections, so that a slow dependency can't starve the others.
+type clientOptions struct {
+	dependency            string
+	timeout               *int
+	maxIdleConnsPerHost   *int
+	maxConnsPerHost       *int
+	tlsCAFile             *string
+	tlsInsecureSkipVerify *bool
+	proxyURL              *string
+}
+
+// declareClientOptions declares the options of the client of the dependency, named with the name and the env var prefix.
+func declareClientOptions(s *settings, dependency string, name string, envPrefix string, timeout int) *clientOptions {
+	return &clientOptions{
+		dependency: dependency,
+		timeout: s.Int(cli.IntOpt{
+			Name:   name + "Timeout",
+			Value:  timeout,
+			Desc:   fmt.Sprintf("Seconds to wait for the responses of %v, including their body. No timeout when 0.", dependency),
+			EnvVar: envPrefix + "_TIMEOUT_SECONDS",
+		}),
+		maxIdleConnsPerHost: s.Int(cli.IntOpt{
+			Name:   name + "MaxIdleConnsPerHost",
+			Value:  20,
+			Desc:   fmt.Sprintf("Idle connections to %v kept for reuse.", dependency),
+			EnvVar: envPrefix + "_MAX_IDLE_CONNS_PER_HOST",
+		}),
+		maxConnsPerHost: s.Int(cli.IntOpt{
+			Name:   name + "MaxConnsPerHost",
+			Value:  0,
+			Desc:   fmt.Sprintf("Connections to %v open at once. Unlimited when 0.", dependency),
+			EnvVar: envPrefix + "_MAX_CONNS_PER_HOST",
+		}),
+		tlsCAFile: s.String(cli.StringOpt{
+			Name:   name + "TlsCaFile",
+			Value:  "",
+			Desc:   fmt.Sprintf("PEM file with the certificate authorities trusted for %v, instead of the system ones.", dependency),
+			EnvVar: envPrefix + "_TLS_CA_FILE",
+		}),
+		tlsInsecureSkipVerify: s.Bool(cli.BoolOpt{
+			Name:   name + "TlsInsecureSkipVerify",
+			Value:  false,
+			Desc:   fmt.Sprintf("Skip the verification of the certificates of %v. For testing only.", dependency),
+			EnvVar: envPrefix + "_TLS_INSECURE_SKIP_VERIFY",
+		}),
+		proxyURL: s.String(cli.StringOpt{
+			Name:   name + "ProxyUrl",
+			Value:  "",
+			Desc:   fmt.Sprintf("Proxy of the requests to %v. The HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars apply when empty.", dependency),
+			EnvVar: envPrefix + "_PROXY_URL",
+		}),
+	}
+}
+
+func (o *clientOptions) newClient() (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost:   *o.maxIdleConnsPerHost,
+		MaxConnsPerHost:       *o.maxConnsPerHost,
+		TLSHandshakeTimeout:   3 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if *o.proxyURL != "" {
+		proxy, err := url.Parse(*o.proxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q for %v", *o.proxyURL, o.dependency)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if *o.tlsCAFile != "" || *o.tlsInsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: *o.tlsInsecureSkipVerify}
+	}
+	if *o.tlsCAFile != "" {
+		pem, err := ioutil.ReadFile(*o.tlsCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the certificate authorities for %v: %v", o.dependency, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate authorities found in %v for %v", *o.tlsCAFile, o.dependency)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	return &http.Client{Transport: transport, Timeout: time.Duration(*o.timeout) * time.Second}, nil
+}
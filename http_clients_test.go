@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClientOptions(t *testing.T, args ...string) *clientOptions {
+	app := cli.App("test", "")
+	s, err := newSettings(app, "")
+	assert.NoError(t, err)
+	o := declareClientOptions(s, "document-store-api", "docStoreApi", "TEST_DOCUMENT_STORE_API", 10)
+	app.Action = func() {}
+	assert.NoError(t, app.Run(append([]string{"test"}, args...)))
+	return o
+}
+
+func TestClientOptions_TrustsTheCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "clients")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+
+	client, err := newTestClientOptions(t).newClient()
+	assert.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err, "the test server certificate is not trusted by default")
+
+	client, err = newTestClientOptions(t, "--docStoreApiTlsCaFile", caFile).newClient()
+	assert.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+}
+
+func TestClientOptions_RejectsInvalidCAFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clients")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caFile, []byte("not a certificate"), 0644))
+
+	_, err = newTestClientOptions(t, "--docStoreApiTlsCaFile", caFile).newClient()
+	assert.Error(t, err)
+	_, err = newTestClientOptions(t, "--docStoreApiTlsCaFile", filepath.Join(dir, "missing.pem")).newClient()
+	assert.Error(t, err)
+}
+
+func TestClientOptions_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := newTestClientOptions(t, "--docStoreApiProxyUrl", proxy.URL).newClient()
+	assert.NoError(t, err)
+	resp, err := client.Get("http://document-store-api.invalid/content/some_uuid")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "http://document-store-api.invalid/content/some_uuid", proxied)
+
+	_, err = newTestClientOptions(t, "--docStoreApiProxyUrl", "not a url").newClient()
+	assert.Error(t, err)
+}
+
+func TestClientOptions_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	o := newTestClientOptions(t, "--docStoreApiTimeout", "1", "--docStoreApiMaxConnsPerHost", "5")
+	client, err := o.newClient()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, client.Timeout)
+	assert.Equal(t, 5, client.Transport.(*http.Transport).MaxConnsPerHost)
+	assert.Equal(t, 20, client.Transport.(*http.Transport).MaxIdleConnsPerHost)
+
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -28,120 +27,661 @@ const serviceName = "post-publication-combiner"
 func main() {
 
 	app := cli.App(serviceName, "Service listening to content and metadata PostPublication events, and forwards a combined message to the queue")
+	logger.InitDefaultLogger(serviceName)
+
+	// the optional config file sets the defaults of the options, so env vars and flags still override it
+	settings, err := newSettings(app, os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		logger.WithError(err).Fatal("Could not load the config file")
+	}
 
-	port := app.String(cli.StringOpt{
+	port := settings.String(cli.StringOpt{
 		Name:   "port",
 		Value:  "8080",
 		Desc:   "Port to listen on",
 		EnvVar: "PORT",
 	})
-	contentTopic := app.String(cli.StringOpt{
+	contentTopic := settings.String(cli.StringOpt{
 		Name:   "contentTopic",
 		Value:  "PostPublicationEvents",
 		EnvVar: "KAFKA_CONTENT_TOPIC_NAME",
-	})
-	metadataTopic := app.String(cli.StringOpt{
+	}, notEmpty)
+	metadataTopic := settings.String(cli.StringOpt{
 		Name:   "metadataTopic",
 		Value:  "PostConceptAnnotations",
 		EnvVar: "KAFKA_METADATA_TOPIC_NAME",
-	})
-	combinedTopic := app.String(cli.StringOpt{
+	}, notEmpty)
+	combinedTopic := settings.String(cli.StringOpt{
 		Name:   "combinedTopic",
 		Value:  "CombinedPostPublicationEvents",
 		EnvVar: "KAFKA_COMBINED_TOPIC_NAME",
-	})
-	forcedCombinedTopic := app.String(cli.StringOpt{
+	}, notEmpty)
+	forcedCombinedTopic := settings.String(cli.StringOpt{
 		Name:   "forcedCombinedTopic",
 		Value:  "ForcedCombinedPostPublicationEvents",
 		EnvVar: "KAFKA_FORCED_COMBINED_TOPIC_NAME",
+	}, notEmpty)
+	combinedOutputFormat := settings.String(cli.StringOpt{
+		Name:   "combinedOutputFormat",
+		Value:  processor.OutputFormatRaw,
+		Desc:   "Format of the messages sent to the combined topic: raw, cloudevents-structured or cloudevents-binary.",
+		EnvVar: "COMBINED_OUTPUT_FORMAT",
+	})
+	forcedCombinedOutputFormat := settings.String(cli.StringOpt{
+		Name:   "forcedCombinedOutputFormat",
+		Value:  processor.OutputFormatRaw,
+		Desc:   "Format of the messages sent to the forced combined topic: raw, cloudevents-structured or cloudevents-binary.",
+		EnvVar: "FORCED_COMBINED_OUTPUT_FORMAT",
+	})
+	combinedSink := settings.String(cli.StringOpt{
+		Name:   "combinedSink",
+		Value:  processor.SinkKafka,
+		Desc:   "Comma separated outputs of the combined messages: kafka (the combined topic), stdout, file:<path> or an http(s) URL.",
+		EnvVar: "COMBINED_SINK",
+	})
+	forcedCombinedSink := settings.String(cli.StringOpt{
+		Name:   "forcedCombinedSink",
+		Value:  processor.SinkKafka,
+		Desc:   "Comma separated outputs of the forced combined messages: kafka (the forced combined topic), stdout, file:<path> or an http(s) URL.",
+		EnvVar: "FORCED_COMBINED_SINK",
+	})
+	httpSinkClientOptions := declareClientOptions(settings, "the HTTP sinks", "httpSink", "HTTP_SINK", 10)
+	combinedEncoding := settings.String(cli.StringOpt{
+		Name:   "combinedEncoding",
+		Value:  processor.EncodingJSON,
+		Desc:   "Encoding of the messages sent to the combined topic: json or avro.",
+		EnvVar: "COMBINED_ENCODING",
+	})
+	forcedCombinedEncoding := settings.String(cli.StringOpt{
+		Name:   "forcedCombinedEncoding",
+		Value:  processor.EncodingJSON,
+		Desc:   "Encoding of the messages sent to the forced combined topic: json or avro.",
+		EnvVar: "FORCED_COMBINED_ENCODING",
+	})
+	schemaRegistryDir := settings.String(cli.StringOpt{
+		Name:   "schemaRegistryDir",
+		Value:  "processor/schema/avro",
+		Desc:   "Directory holding the avro schemas, named <subject>.<id>.avsc.",
+		EnvVar: "AVRO_SCHEMA_REGISTRY_DIR",
+	})
+	schemaSubject := settings.String(cli.StringOpt{
+		Name:   "schemaSubject",
+		Value:  processor.DefaultSchemaSubject,
+		Desc:   "Subject of the avro schema used to encode the combined messages.",
+		EnvVar: "AVRO_SCHEMA_SUBJECT",
+	})
+	combinedCompression := settings.String(cli.StringOpt{
+		Name:   "combinedCompression",
+		Value:  processor.CompressionNone,
+		Desc:   "Compression of the messages sent to the combined topic: none, gzip or zstd.",
+		EnvVar: "COMBINED_COMPRESSION",
+	})
+	forcedCombinedCompression := settings.String(cli.StringOpt{
+		Name:   "forcedCombinedCompression",
+		Value:  processor.CompressionNone,
+		Desc:   "Compression of the messages sent to the forced combined topic: none, gzip or zstd.",
+		EnvVar: "FORCED_COMBINED_COMPRESSION",
+	})
+	maxMessageBytes := settings.Int(cli.IntOpt{
+		Name:   "maxMessageBytes",
+		Value:  0,
+		Desc:   "Maximum size of the combined messages, once encoded and compressed. 0 doesn't limit the size.",
+		EnvVar: "MAX_MESSAGE_BYTES",
+	})
+	oversizeAction := settings.String(cli.StringOpt{
+		Name:   "oversizeAction",
+		Value:  processor.SizeActionDeadLetter,
+		Desc:   "What to do with the messages bigger than the maximum size: dead-letter, or reference (store them in the blobs directory and send a pointer).",
+		EnvVar: "OVERSIZE_ACTION",
+	})
+	combinedClaimCheck := settings.Bool(cli.BoolOpt{
+		Name:   "combinedClaimCheck",
+		Value:  false,
+		Desc:   "Store the messages for the combined topic in the blobs directory, and send references to them instead.",
+		EnvVar: "COMBINED_CLAIM_CHECK",
+	})
+	forcedCombinedClaimCheck := settings.Bool(cli.BoolOpt{
+		Name:   "forcedCombinedClaimCheck",
+		Value:  false,
+		Desc:   "Store the messages for the forced combined topic in the blobs directory, and send references to them instead.",
+		EnvVar: "FORCED_COMBINED_CLAIM_CHECK",
+	})
+	blobsDir := settings.String(cli.StringOpt{
+		Name:   "blobsDir",
+		Value:  "",
+		Desc:   "Directory storing the messages sent as references.",
+		EnvVar: "BLOBS_DIR",
+	})
+	webhookSubscribersFile := settings.String(cli.StringOpt{
+		Name:   "webhookSubscribersFile",
+		Value:  "",
+		Desc:   "JSON file of the webhook subscribers receiving the forwarded combined messages. When empty, there are no webhook deliveries.",
+		EnvVar: "WEBHOOK_SUBSCRIBERS_FILE",
+	})
+	webhookMaxAttempts := settings.Int(cli.IntOpt{
+		Name:   "webhookMaxAttempts",
+		Value:  processor.DefaultWebhookMaxAttempts,
+		Desc:   "Number of times a webhook delivery is attempted.",
+		EnvVar: "WEBHOOK_MAX_ATTEMPTS",
+	})
+	webhookClientOptions := declareClientOptions(settings, "the webhook subscribers", "webhook", "WEBHOOK", 10)
+	historyCapacity := settings.Int(cli.IntOpt{
+		Name:   "historyCapacity",
+		Value:  processor.DefaultHistoryCapacity,
+		Desc:   "Number of the most recent processing outcomes kept for /__history. No history is kept when 0.",
+		EnvVar: "HISTORY_CAPACITY",
+	}, notNegative)
+	historyPath := settings.String(cli.StringOpt{
+		Name:   "historyPath",
+		Value:  "",
+		Desc:   "File persisting the processing history. When empty, it's kept in memory only.",
+		EnvVar: "HISTORY_PATH",
+	})
+	whitelistsFile := settings.String(cli.StringOpt{
+		Name:   "whitelistsFile",
+		Value:  "",
+		Desc:   "JSON file with the contentURIs, originSystemIds and contentTypes whitelists, reloaded when it changes and replacing the WHITELISTED_* settings. When empty, the whitelists only change through /__whitelists.",
+		EnvVar: "WHITELISTS_FILE",
+	})
+	adminAPIKey := settings.String(cli.StringOpt{
+		Name:      "adminApiKey",
+		Value:     "",
+		Desc:      "Bearer token of the admin calls, to /__whitelists and to pause and resume the consumers. When empty, these can't be called.",
+		EnvVar:    "ADMIN_API_KEY",
+		HideValue: true,
+	})
+	authMode := settings.String(cli.StringOpt{
+		Name:   "authMode",
+		Value:  AuthNone,
+		Desc:   "Authentication of the endpoints, but the health, gtg, ping and build-info ones: none, api-key (X-Api-Key header), hmac (signed requests) or jwt (bearer tokens).",
+		EnvVar: "AUTH_MODE",
+	})
+	authCallersFile := settings.String(cli.StringOpt{
+		Name:   "authCallersFile",
+		Value:  "",
+		Desc:   "JSON file with the name and the key of every caller, for the api-key and hmac modes.",
+		EnvVar: "AUTH_CALLERS_FILE",
 	})
-	kafkaProxyAddress := app.String(cli.StringOpt{
+	authJWKSFile := settings.String(cli.StringOpt{
+		Name:   "authJwksFile",
+		Value:  "",
+		Desc:   "JWKS file with the public keys verifying the tokens, for the jwt mode.",
+		EnvVar: "AUTH_JWKS_FILE",
+	})
+	authJWTIssuer := settings.String(cli.StringOpt{
+		Name:   "authJwtIssuer",
+		Value:  "",
+		Desc:   "Issuer expected in the tokens, for the jwt mode. Any issuer is accepted when empty.",
+		EnvVar: "AUTH_JWT_ISSUER",
+	})
+	authJWTAudience := settings.String(cli.StringOpt{
+		Name:   "authJwtAudience",
+		Value:  "",
+		Desc:   "Audience expected in the tokens, for the jwt mode. Any audience is accepted when empty.",
+		EnvVar: "AUTH_JWT_AUDIENCE",
+	})
+	authMaxClockSkew := settings.Int(cli.IntOpt{
+		Name:   "authMaxClockSkew",
+		Value:  int(DefaultMaxClockSkew / time.Second),
+		Desc:   "Seconds signed requests and tokens are accepted for, before or after their timestamps.",
+		EnvVar: "AUTH_MAX_CLOCK_SKEW_SECONDS",
+	})
+	forceRateLimit := settings.Int(cli.IntOpt{
+		Name:   "forceRateLimit",
+		Value:  0,
+		Desc:   "Force requests accepted per second, from all the callers. Unlimited when 0.",
+		EnvVar: "FORCE_RATE_LIMIT",
+	})
+	forceRateBurst := settings.Int(cli.IntOpt{
+		Name:   "forceRateBurst",
+		Value:  10,
+		Desc:   "Force requests accepted at once, from all the callers, over the rate limit.",
+		EnvVar: "FORCE_RATE_BURST",
+	})
+	forceCallerRateLimit := settings.Int(cli.IntOpt{
+		Name:   "forceCallerRateLimit",
+		Value:  0,
+		Desc:   "Force requests accepted per second, from every caller. Unlimited when 0.",
+		EnvVar: "FORCE_CALLER_RATE_LIMIT",
+	})
+	forceCallerRateBurst := settings.Int(cli.IntOpt{
+		Name:   "forceCallerRateBurst",
+		Value:  10,
+		Desc:   "Force requests accepted at once, from every caller, over the rate limit.",
+		EnvVar: "FORCE_CALLER_RATE_BURST",
+	})
+	forceMaxConcurrent := settings.Int(cli.IntOpt{
+		Name:   "forceMaxConcurrent",
+		Value:  0,
+		Desc:   "Force requests processed at once. Unlimited when 0.",
+		EnvVar: "FORCE_MAX_CONCURRENT",
+	})
+	apiMaxConcurrentRequests := settings.Int(cli.IntOpt{
+		Name:   "apiMaxConcurrentRequests",
+		Value:  20,
+		Desc:   "Requests to document-store-api and public-annotations-api made at once.",
+		EnvVar: "API_MAX_CONCURRENT_REQUESTS",
+	})
+	forcedAPIMaxConcurrentRequests := settings.Int(cli.IntOpt{
+		Name:   "forcedApiMaxConcurrentRequests",
+		Value:  5,
+		Desc:   "Requests to document-store-api and public-annotations-api made at once for force requests, which also wait for the requests of the consumed messages.",
+		EnvVar: "FORCED_API_MAX_CONCURRENT_REQUESTS",
+	})
+	deadLetterTopic := settings.String(cli.StringOpt{
+		Name:   "deadLetterTopic",
+		Value:  "",
+		Desc:   "Topic receiving the messages that could not be processed. When empty, such messages are only logged.",
+		EnvVar: "KAFKA_DEAD_LETTER_TOPIC_NAME",
+	})
+	maxDeliveryAttempts := settings.Int(cli.IntOpt{
+		Name:   "maxDeliveryAttempts",
+		Value:  processor.DefaultMaxDeliveryAttempts,
+		Desc:   "Number of times a consumed message is processed before it is dead-lettered.",
+		EnvVar: "MAX_DELIVERY_ATTEMPTS",
+	})
+	redeliveryBackoff := settings.Int(cli.IntOpt{
+		Name:   "redeliveryBackoff",
+		Value:  int(processor.DefaultRedeliveryBackoff / time.Second),
+		Desc:   "Seconds to wait before redelivering a message that failed processing.",
+		EnvVar: "REDELIVERY_BACKOFF_SECONDS",
+	})
+	retryStages := settings.String(cli.StringOpt{
+		Name:   "retryStages",
+		Value:  "",
+		Desc:   "Comma separated delays of the retries of messages failing with a transient error, e.g. 10s,1m,10m. When empty, messages are redelivered in place, up to the maximum delivery attempts.",
+		EnvVar: "RETRY_STAGES",
+	})
+	retriesDir := settings.String(cli.StringOpt{
+		Name:   "retriesDir",
+		Value:  "",
+		Desc:   "Directory persisting the pending retries. Required with retry stages, as the messages are committed once their retry is scheduled.",
+		EnvVar: "RETRIES_DIR",
+	})
+	staleContentAction := settings.String(cli.StringOpt{
+		Name:   "staleContentAction",
+		Value:  processor.StaleActionRetry,
+		Desc:   "What to do when the content read is older than the one already forwarded: retry or forward (marked as stale).",
+		EnvVar: "STALE_CONTENT_ACTION",
+	})
+	staleContentMaxRetries := settings.Int(cli.IntOpt{
+		Name:   "staleContentMaxRetries",
+		Value:  3,
+		Desc:   "Number of times the content is read again when it's older than the one already forwarded. The retries stop after 5 seconds of waiting.",
+		EnvVar: "STALE_CONTENT_MAX_RETRIES",
+	})
+	staleContentRetryDelay := settings.Int(cli.IntOpt{
+		Name:   "staleContentRetryDelay",
+		Value:  500,
+		Desc:   "Milliseconds to wait before reading the content again.",
+		EnvVar: "STALE_CONTENT_RETRY_DELAY_MS",
+	})
+	skipUnchanged := settings.Bool(cli.BoolOpt{
+		Name:   "skipUnchanged",
+		Value:  false,
+		Desc:   "Don't forward a combined message to the combined topic when it's the same as the last one forwarded for the UUID. Forced messages are always forwarded.",
+		EnvVar: "SKIP_UNCHANGED_MESSAGES",
+	})
+	contentFailureAction := settings.String(cli.StringOpt{
+		Name:   "contentFailureAction",
+		Value:  processor.FailureActionRetry,
+		Desc:   "What to do with content messages when the annotations can't be read: drop, retry, or forward the content without annotations and combine it again later.",
+		EnvVar: "CONTENT_ANNOTATIONS_FAILURE_ACTION",
+	})
+	metadataFailureAction := settings.String(cli.StringOpt{
+		Name:   "metadataFailureAction",
+		Value:  processor.FailureActionRetry,
+		Desc:   "What to do with annotations messages when the annotations can't be read: drop, retry, or forward the content without annotations and combine it again later.",
+		EnvVar: "METADATA_ANNOTATIONS_FAILURE_ACTION",
+	})
+	recombineInterval := settings.Int(cli.IntOpt{
+		Name:   "recombineInterval",
+		Value:  int(processor.DefaultRecombineInterval / time.Second),
+		Desc:   "Seconds between the attempts to combine again the content forwarded without annotations.",
+		EnvVar: "RECOMBINE_INTERVAL_SECONDS",
+	})
+	stateStore := settings.String(cli.StringOpt{
+		Name:   "stateStore",
+		Value:  processor.StateStoreMemory,
+		Desc:   "Store of the per-UUID state (watermarks, hashes): memory, or bolt to persist it in the state database.",
+		EnvVar: "STATE_STORE",
+	})
+	stateDBPath := settings.String(cli.StringOpt{
+		Name:   "stateDBPath",
+		Value:  "state/combiner.db",
+		Desc:   "Path of the state database, used with the bolt state store.",
+		EnvVar: "STATE_DB_PATH",
+	})
+	stateTTL := settings.Int(cli.IntOpt{
+		Name:   "stateTTL",
+		Value:  int(processor.DefaultStateTTL / time.Hour),
+		Desc:   "Hours the per-UUID state is kept after it was last written. 0 keeps it until it's evicted.",
+		EnvVar: "STATE_TTL_HOURS",
+	})
+	kafkaProxyAddress := settings.String(cli.StringOpt{
 		Name:   "kafkaProxyAddress",
 		Value:  "http://localhost:8080",
 		Desc:   "Address used by the queue consumer and producer to connect to the queue",
 		EnvVar: "KAFKA_PROXY_ADDR",
-	})
-	kafkaContentConsumerGroup := app.String(cli.StringOpt{
+	}, validURL)
+	kafkaContentConsumerGroup := settings.String(cli.StringOpt{
 		Name:   "kafkaContentTopicConsumerGroup",
 		Value:  "content-post-publication-combiner",
 		Desc:   "Group used to read the messages from the content queue",
 		EnvVar: "KAFKA_PROXY_CONTENT_CONSUMER_GROUP",
-	})
-	kafkaMetadataConsumerGroup := app.String(cli.StringOpt{
+	}, notEmpty)
+	kafkaMetadataConsumerGroup := settings.String(cli.StringOpt{
 		Name:   "kafkaMetadataTopicConsumerGroup",
 		Value:  "metadata-post-publication-combiner",
 		Desc:   "Group used to read the messages from the metadata queue",
 		EnvVar: "KAFKA_PROXY_METADATA_CONSUMER_GROUP",
-	})
-	kafkaProxyRoutingHeader := app.String(cli.StringOpt{
+	}, notEmpty)
+	kafkaProxyRoutingHeader := settings.String(cli.StringOpt{
 		Name:   "kafkaProxyHeader",
 		Value:  "kafka",
 		Desc:   "Kafka proxy header - used for vulcan routing.",
 		EnvVar: "KAFKA_PROXY_HOST_HEADER",
 	})
+	kafkaProxyClientOptions := declareClientOptions(settings, "kafka-proxy", "kafkaProxy", "KAFKA_PROXY", 30)
 
-	docStoreAPIBaseURL := app.String(cli.StringOpt{
+	docStoreAPIBaseURL := settings.String(cli.StringOpt{
 		Name:   "docStoreApiBaseURL",
 		Value:  "http://localhost:8080/__document-store-api",
 		Desc:   "The address that the document store can be reached at. Important for content retrieval.",
 		EnvVar: "DOCUMENT_STORE_BASE_URL",
-	})
-	docStoreAPIEndpoint := app.String(cli.StringOpt{
+	}, validURL)
+	docStoreAPIEndpoint := settings.String(cli.StringOpt{
 		Name:   "docStoreApiEndpoint",
 		Value:  "/content/{uuid}",
 		Desc:   "The endpoint used for content retrieval.",
 		EnvVar: "DOCUMENT_STORE_API_ENDPOINT",
-	})
-	publicAnnotationsAPIBaseURL := app.String(cli.StringOpt{
+	}, withUUIDPlaceholder)
+	publicAnnotationsAPIBaseURL := settings.String(cli.StringOpt{
 		Name:   "publicAnnotationsApiBaseURL",
 		Value:  "http://localhost:8080/__public-annotations-api",
 		Desc:   "The address that the public-annotations-api can be reached at. Important for metadata retrieval.",
 		EnvVar: "PUBLIC_ANNOTATIONS_API_BASE_URL",
-	})
-	publicAnnotationsAPIEndpoint := app.String(cli.StringOpt{
+	}, validURL)
+	publicAnnotationsAPIEndpoint := settings.String(cli.StringOpt{
 		Name:   "publicAnnotationsApiEndpoint",
 		Value:  "/content/{uuid}/annotations",
 		Desc:   "The endpoint used for metadata retrieval.",
 		EnvVar: "PUBLIC_ANNOTATIONS_API_ENDPOINT",
-	})
-	whitelistedMetadataOriginSystemHeaders := app.Strings(cli.StringsOpt{
+	}, withUUIDPlaceholder)
+	docStoreAPIClientOptions := declareClientOptions(settings, "document-store-api", "docStoreApi", "DOCUMENT_STORE_API", 10)
+	publicAnnotationsAPIClientOptions := declareClientOptions(settings, "public-annotations-api", "publicAnnotationsApi", "PUBLIC_ANNOTATIONS_API", 10)
+	whitelistedMetadataOriginSystemHeaders := settings.Strings(cli.StringsOpt{
 		Name:   "whitelistedMetadataOriginSystemHeaders",
 		Value:  []string{"http://cmdb.ft.com/systems/pac", "http://cmdb.ft.com/systems/methode-web-pub", "http://cmdb.ft.com/systems/next-video-editor"},
 		Desc:   "Origin-System-Ids that are supported to be processed from the PostPublicationEvents queue.",
 		EnvVar: "WHITELISTED_METADATA_ORIGIN_SYSTEM_HEADERS",
-	})
-	whitelistedContentUris := app.Strings(cli.StringsOpt{
+	}, withoutEmptyValues)
+	whitelistedContentUris := settings.Strings(cli.StringsOpt{
 		Name:   "whitelistedContentURIs",
 		Value:  []string{"methode-article-mapper", "wordpress-article-mapper", "next-video-mapper", "upp-content-validator"},
-		Desc:   "Space separated list with content URI substrings - to identify accepted content types.",
+		Desc:   "Comma separated list with content URI substrings - to identify accepted content types.",
 		EnvVar: "WHITELISTED_CONTENT_URIS",
-	})
-	whitelistedContentTypes := app.Strings(cli.StringsOpt{
+	}, withoutEmptyValues)
+	whitelistedContentTypes := settings.Strings(cli.StringsOpt{
 		Name:   "whitelistedContentTypes",
-		Value:  []string{"Article", "Video", "MediaResource", "Audio", ""},
-		Desc:   "Space separated list with content types - to identify accepted content types.",
+		Value:  []string{"Article", "Video", "MediaResource", "Audio"},
+		Desc:   "Comma separated list with content types - to identify accepted content types.",
 		EnvVar: "WHITELISTED_CONTENT_TYPES",
+	}, withoutEmptyValues)
+	allowUntypedContent := settings.Bool(cli.BoolOpt{
+		Name:   "allowUntypedContent",
+		Value:  true,
+		Desc:   "Forward the content without a type, whatever the whitelisted content types.",
+		EnvVar: "ALLOW_UNTYPED_CONTENT",
 	})
 
-	logger.InitDefaultLogger(serviceName)
+	if err := settings.FileErr(); err != nil {
+		logger.WithError(err).Fatal("Invalid config file")
+	}
+	app.Before = func() {
+		if err := settings.Validate(); err != nil {
+			logger.WithError(err).Fatal("Invalid configuration")
+		}
+	}
+
+	app.Command("replay", "Process messages captured from the content and metadata topics, and write the combined messages to a file instead of the combined topic", func(cmd *cli.Cmd) {
+		cmd.Spec = "[--topic] [--output] INPUT"
+		input := cmd.StringArg("INPUT", "", "JSON lines file of the captured messages, with their Headers and Body, and optionally the Topic they were read from.")
+		topic := cmd.StringOpt("topic", "", "Topic the captured messages were read from, when not captured with the messages. The content topic by default.")
+		output := cmd.StringOpt("output", "", "File the combined messages are written to, as JSON lines. Standard output by default.")
+
+		cmd.Action = func() {
+			if err := processor.ValidateOutputFormat(*combinedOutputFormat); err != nil {
+				logger.WithError(err).Fatal("Invalid output format")
+			}
+			if err := processor.ValidateEncoding(*combinedEncoding, *combinedOutputFormat); err != nil {
+				logger.WithError(err).Fatal("Invalid encoding")
+			}
+			if err := processor.ValidateCompression(*combinedCompression); err != nil {
+				logger.WithError(err).Fatal("Invalid compression")
+			}
+			stalePolicy, err := processor.NewStalePolicy(*staleContentAction, *staleContentMaxRetries, time.Duration(*staleContentRetryDelay)*time.Millisecond)
+			if err != nil {
+				logger.WithError(err).Fatal("Invalid stale content configuration")
+			}
+			var schemaRegistry processor.SchemaRegistry
+			if *combinedEncoding == processor.EncodingAvro {
+				if schemaRegistry, err = processor.NewFileSchemaRegistry(*schemaRegistryDir); err != nil {
+					logger.WithError(err).Fatal("Could not load the avro schemas")
+				}
+			}
+			encoder, err := processor.NewPayloadEncoder(*combinedEncoding, schemaRegistry, *schemaSubject)
+			if err != nil {
+				logger.WithError(err).Fatal("Could not initialise the combined messages encoder")
+			}
+
+			in, err := os.Open(*input)
+			if err != nil {
+				logger.WithError(err).Fatal("Could not open the captured messages")
+			}
+			defer in.Close()
+			out := os.Stdout
+			if *output != "" {
+				if out, err = os.Create(*output); err != nil {
+					logger.WithError(err).Fatal("Could not create the output file")
+				}
+				defer out.Close()
+			}
+
+			docStoreAPIClient, err := docStoreAPIClientOptions.newClient()
+			if err != nil {
+				logger.WithError(err).Fatal("Invalid document-store-api client")
+			}
+			publicAnnotationsAPIClient, err := publicAnnotationsAPIClientOptions.newClient()
+			if err != nil {
+				logger.WithError(err).Fatal("Invalid public-annotations-api client")
+			}
+			dataCombiner := processor.NewDataCombiner(utils.ApiURL{BaseURL: *docStoreAPIBaseURL, Endpoint: *docStoreAPIEndpoint},
+				utils.ApiURL{BaseURL: *publicAnnotationsAPIBaseURL, Endpoint: *publicAnnotationsAPIEndpoint}, docStoreAPIClient, publicAnnotationsAPIClient)
+			processorConf := processor.NewMsgProcessorConfig(*whitelistedContentUris, *whitelistedMetadataOriginSystemHeaders, *contentTopic, *metadataTopic)
+			processorConf.StalePolicy = stalePolicy
+			processorConf.FailurePolicies = map[string]string{
+				*contentTopic:  *contentFailureAction,
+				*metadataTopic: *metadataFailureAction,
+			}
+			// the state is not shared with the running service, the replay starts from an empty one
+			messagesCh := make(chan *processor.KafkaQMessage)
+			msgProcessor := processor.NewMsgProcessor(messagesCh, processorConf, dataCombiner, processor.NewWriterSink(out), *whitelistedContentTypes)
+			msgProcessor.State = processor.NewInMemoryStateStore(processor.DefaultStateCapacity, 0)
+			msgProcessor.Forwarder.AllowUntypedContent = *allowUntypedContent
+			msgProcessor.Forwarder.OutputFormat = *combinedOutputFormat
+			msgProcessor.Forwarder.Encoder = encoder
+			msgProcessor.Forwarder.Compression = *combinedCompression
+			if *skipUnchanged {
+				msgProcessor.Forwarder.Hashes = processor.NewHashStore(msgProcessor.State)
+				msgProcessor.Forwarder.SkipUnchanged = true
+			}
+			go msgProcessor.ProcessMessages()
+
+			if *topic == "" {
+				*topic = *contentTopic
+			}
+			stats, err := processor.Replay(in, *topic, messagesCh)
+			if err != nil {
+				logger.WithError(err).Fatal("Replay interrupted")
+			}
+			logger.Infof("Replayed %d messages, %d failed", stats.Processed+stats.Failed, stats.Failed)
+		}
+	})
 
 	app.Action = func() {
-		client := http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).DialContext,
-				MaxIdleConnsPerHost:   20,
-				TLSHandshakeTimeout:   3 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-			},
+		// every dependency has its own connections, so that a slow one can't starve the others
+		kafkaProxyClient, err := kafkaProxyClientOptions.newClient()
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid kafka-proxy client")
+		}
+		docStoreAPIClient, err := docStoreAPIClientOptions.newClient()
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid document-store-api client")
+		}
+		publicAnnotationsAPIClient, err := publicAnnotationsAPIClientOptions.newClient()
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid public-annotations-api client")
+		}
+		httpSinkClient, err := httpSinkClientOptions.newClient()
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid HTTP sinks client")
+		}
+		webhookClient, err := webhookClientOptions.newClient()
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid webhooks client")
 		}
 
 		// create channel for holding the post publication content and metadata messages
 		messagesCh := make(chan *processor.KafkaQMessage, 100)
 
+		// messages are acknowledged only once forwarded, or once parked on the dead-letter path
+		deliveryPolicy := processor.NewDeliveryPolicy(*maxDeliveryAttempts, time.Duration(*redeliveryBackoff)*time.Second)
+		var deadLetterProducer producer.MessageProducer
+		if *deadLetterTopic != "" {
+			deadLetterProducer = producer.NewMessageProducerWithHTTPClient(processor.NewProducerConfig(*kafkaProxyAddress, *deadLetterTopic, *kafkaProxyRoutingHeader), kafkaProxyClient)
+		}
+		deadLetterQueue := processor.NewDeadLetterQueue(deadLetterProducer)
+
+		var retryQueue *processor.RetryQueue
+		if *retryStages != "" {
+			stages, err := processor.ParseRetryStages(*retryStages)
+			if err != nil {
+				logger.WithError(err).Fatal("Invalid retry stages")
+			}
+			if retryQueue, err = processor.NewRetryQueue(stages, messagesCh, deadLetterQueue, *retriesDir); err != nil {
+				logger.WithError(err).Fatal("Could not initialise the retry queue")
+			}
+			if deliveryPolicy.Backoff > 0 {
+				retryQueue.Backoff = deliveryPolicy.Backoff
+			}
+			go retryQueue.Start()
+			defer retryQueue.Stop()
+		}
+
+		// the lastModified of the forwarded content is tracked per uuid, to detect content read from lagging replicas
+		stalePolicy, err := processor.NewStalePolicy(*staleContentAction, *staleContentMaxRetries, time.Duration(*staleContentRetryDelay)*time.Millisecond)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid stale content configuration")
+		}
+		// the state store is shared by the message and the request processors
+		state, err := processor.NewStateStore(*stateStore, *stateDBPath, time.Duration(*stateTTL)*time.Hour)
+		if err != nil {
+			logger.WithError(err).Fatal("Could not initialise the state store")
+		}
+		defer state.Close()
+
+		watermarks := processor.NewWatermarkStore(state)
+		var hashes processor.HashStore
+		if *skipUnchanged {
+			hashes = processor.NewHashStore(state)
+		}
+
+		for _, format := range []string{*combinedOutputFormat, *forcedCombinedOutputFormat} {
+			if err := processor.ValidateOutputFormat(format); err != nil {
+				logger.WithError(err).Fatal("Invalid output format")
+			}
+		}
+		if err := processor.ValidateEncoding(*combinedEncoding, *combinedOutputFormat); err != nil {
+			logger.WithError(err).Fatal("Invalid encoding")
+		}
+		if err := processor.ValidateEncoding(*forcedCombinedEncoding, *forcedCombinedOutputFormat); err != nil {
+			logger.WithError(err).Fatal("Invalid encoding")
+		}
+		for _, action := range []string{*contentFailureAction, *metadataFailureAction} {
+			if err := processor.ValidateFailureAction(action); err != nil {
+				logger.WithError(err).Fatal("Invalid annotations failure action")
+			}
+		}
+
+		for _, compression := range []string{*combinedCompression, *forcedCombinedCompression} {
+			if err := processor.ValidateCompression(compression); err != nil {
+				logger.WithError(err).Fatal("Invalid compression")
+			}
+		}
+		sizePolicy, err := processor.NewSizePolicy(*maxMessageBytes, *oversizeAction)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid message size configuration")
+		}
+		var blobs processor.BlobStore
+		if sizePolicy.Action == processor.SizeActionReference || *combinedClaimCheck || *forcedCombinedClaimCheck {
+			if *blobsDir == "" {
+				logger.Fatal("The blobs directory is required for sending messages as references")
+			}
+			if blobs, err = processor.NewFileBlobStore(*blobsDir); err != nil {
+				logger.WithError(err).Fatal("Could not initialise the blob store")
+			}
+		}
+		var schemaRegistry processor.SchemaRegistry
+		if *combinedEncoding == processor.EncodingAvro || *forcedCombinedEncoding == processor.EncodingAvro {
+			if schemaRegistry, err = processor.NewFileSchemaRegistry(*schemaRegistryDir); err != nil {
+				logger.WithError(err).Fatal("Could not load the avro schemas")
+			}
+		}
+		combinedEncoder, err := processor.NewPayloadEncoder(*combinedEncoding, schemaRegistry, *schemaSubject)
+		if err != nil {
+			logger.WithError(err).Fatal("Could not initialise the combined messages encoder")
+		}
+		forcedCombinedEncoder, err := processor.NewPayloadEncoder(*forcedCombinedEncoding, schemaRegistry, *schemaSubject)
+		if err != nil {
+			logger.WithError(err).Fatal("Could not initialise the forced combined messages encoder")
+		}
+
+		var webhooks *processor.Webhooks
+		if *webhookSubscribersFile != "" {
+			subscribers, err := processor.LoadSubscribers(*webhookSubscribersFile)
+			if err != nil {
+				logger.WithError(err).Fatal("Could not load the webhook subscribers")
+			}
+			webhooks = processor.NewWebhooks(subscribers, webhookClient)
+			webhooks.MaxAttempts = *webhookMaxAttempts
+			webhooks.Start()
+			defer webhooks.Stop()
+		}
+
+		// the outcome of every message and force request is kept, to tell what happened to a UUID
+		history, err := processor.NewHistory(*historyCapacity, *historyPath)
+		if err != nil {
+			logger.WithError(err).Fatal("Could not load the processing history")
+		}
+		go history.Start()
+		defer history.Stop()
+
+		// the whitelists are shared by the processors, so that they change for all of them at once
+		whitelists, err := processor.NewWhitelists(processor.Whitelist{
+			ContentURIs:  *whitelistedContentUris,
+			Origins:      *whitelistedMetadataOriginSystemHeaders,
+			ContentTypes: *whitelistedContentTypes,
+		}, *whitelistsFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid whitelists")
+		}
+		go whitelists.Start()
+		defer whitelists.Stop()
+
+		// the forwarded messages are streamed to the clients of the live feed
+		feed := processor.NewLiveFeed()
+
 		// consume messages from content queue
 		cConf := consumer.QueueConfig{
 			Addrs: []string{*kafkaProxyAddress},
@@ -149,9 +689,10 @@ func main() {
 			Topic: *contentTopic,
 			Queue: *kafkaProxyRoutingHeader,
 		}
-		cc := processor.NewKafkaQConsumer(cConf, messagesCh, &client)
-		go cc.Consumer.Start()
-		defer cc.Consumer.Stop()
+		cc := processor.NewKafkaQConsumer(cConf, messagesCh, kafkaProxyClient, deliveryPolicy, deadLetterQueue)
+		cc.Retries = retryQueue
+		go cc.Start()
+		defer cc.Stop()
 
 		// consume messages from metadata queue
 		mConf := consumer.QueueConfig{
@@ -160,51 +701,121 @@ func main() {
 			Topic: *metadataTopic,
 			Queue: *kafkaProxyRoutingHeader,
 		}
-		mc := processor.NewKafkaQConsumer(mConf, messagesCh, &client)
-		go mc.Consumer.Start()
-		defer mc.Consumer.Stop()
+		mc := processor.NewKafkaQConsumer(mConf, messagesCh, kafkaProxyClient, deliveryPolicy, deadLetterQueue)
+		mc.Retries = retryQueue
+		go mc.Start()
+		defer mc.Stop()
+
+		// the consumed messages get the document-store-api and public-annotations-api connections before the force requests
+		docStoreAPILimiter := utils.NewPriorityLimiter(*apiMaxConcurrentRequests, *forcedAPIMaxConcurrentRequests)
+		publicAnnotationsAPILimiter := utils.NewPriorityLimiter(*apiMaxConcurrentRequests, *forcedAPIMaxConcurrentRequests)
 
 		// process and forward messages
 		dataCombiner := processor.NewDataCombiner(utils.ApiURL{BaseURL: *docStoreAPIBaseURL, Endpoint: *docStoreAPIEndpoint},
-			utils.ApiURL{BaseURL: *publicAnnotationsAPIBaseURL, Endpoint: *publicAnnotationsAPIEndpoint}, &client)
+			utils.ApiURL{BaseURL: *publicAnnotationsAPIBaseURL, Endpoint: *publicAnnotationsAPIEndpoint},
+			docStoreAPILimiter.High(docStoreAPIClient), publicAnnotationsAPILimiter.High(publicAnnotationsAPIClient))
 
 		pQConf := processor.NewProducerConfig(*kafkaProxyAddress, *combinedTopic, *kafkaProxyRoutingHeader)
-		msgProducer := producer.NewMessageProducerWithHTTPClient(pQConf, &client)
+		msgSink, err := processor.NewSink(*combinedSink, producer.NewMessageProducerWithHTTPClient(pQConf, kafkaProxyClient), httpSinkClient)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid combined messages sink")
+		}
 		processorConf := processor.NewMsgProcessorConfig(
 			*whitelistedContentUris,
 			*whitelistedMetadataOriginSystemHeaders,
 			*contentTopic,
 			*metadataTopic,
 		)
+		processorConf.StalePolicy = stalePolicy
+		processorConf.FailurePolicies = map[string]string{
+			*contentTopic:  *contentFailureAction,
+			*metadataTopic: *metadataFailureAction,
+		}
 		msgProcessor := processor.NewMsgProcessor(
 			messagesCh,
 			processorConf,
 			dataCombiner,
-			msgProducer,
+			msgSink,
 			*whitelistedContentTypes)
+		msgProcessor.State = state
+		msgProcessor.History = history
+		msgProcessor.Whitelists = whitelists
+		msgProcessor.Forwarder.Watermarks = watermarks
+		msgProcessor.Forwarder.OutputFormat = *combinedOutputFormat
+		msgProcessor.Forwarder.Encoder = combinedEncoder
+		msgProcessor.Forwarder.Compression = *combinedCompression
+		msgProcessor.Forwarder.SizePolicy = sizePolicy
+		msgProcessor.Forwarder.ClaimCheck = *combinedClaimCheck
+		msgProcessor.Forwarder.Hashes = hashes
+		msgProcessor.Forwarder.SkipUnchanged = *skipUnchanged
+		msgProcessor.Forwarder.Blobs = blobs
+		msgProcessor.Forwarder.Webhooks = webhooks
+		msgProcessor.Forwarder.Feed = feed
+		msgProcessor.Forwarder.Topic = *combinedTopic
+		msgProcessor.Forwarder.Whitelists = whitelists
+		msgProcessor.Forwarder.AllowUntypedContent = *allowUntypedContent
+		recombiner := processor.NewRecombiner(dataCombiner, &msgProcessor.Forwarder, time.Duration(*recombineInterval)*time.Second)
+		msgProcessor.Recombiner = recombiner
+		go recombiner.Start()
+		defer recombiner.Stop()
 		go msgProcessor.ProcessMessages()
 
 		// process requested messages - used for reindexing and forced requests
 		forcedPQConf := processor.NewProducerConfig(*kafkaProxyAddress, *forcedCombinedTopic, *kafkaProxyRoutingHeader)
-		forcedMsgProducer := producer.NewMessageProducerWithHTTPClient(forcedPQConf, &client)
+		forcedMsgSink, err := processor.NewSink(*forcedCombinedSink, producer.NewMessageProducerWithHTTPClient(forcedPQConf, kafkaProxyClient), httpSinkClient)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid forced combined messages sink")
+		}
+		forcedDataCombiner := processor.NewDataCombiner(utils.ApiURL{BaseURL: *docStoreAPIBaseURL, Endpoint: *docStoreAPIEndpoint},
+			utils.ApiURL{BaseURL: *publicAnnotationsAPIBaseURL, Endpoint: *publicAnnotationsAPIEndpoint},
+			docStoreAPILimiter.Low(docStoreAPIClient), publicAnnotationsAPILimiter.Low(publicAnnotationsAPIClient))
 		requestProcessor := processor.NewRequestProcessor(
-			dataCombiner,
-			forcedMsgProducer,
+			forcedDataCombiner,
+			forcedMsgSink,
 			*whitelistedContentTypes)
+		requestProcessor.Limits = processor.NewForceLimits(*forceRateLimit, *forceRateBurst, *forceCallerRateLimit, *forceCallerRateBurst, *forceMaxConcurrent)
+		requestProcessor.StalePolicy = stalePolicy
+		requestProcessor.State = state
+		requestProcessor.History = history
+		requestProcessor.Forwarder.Watermarks = watermarks
+		requestProcessor.Forwarder.OutputFormat = *forcedCombinedOutputFormat
+		requestProcessor.Forwarder.Encoder = forcedCombinedEncoder
+		requestProcessor.Forwarder.Compression = *forcedCombinedCompression
+		requestProcessor.Forwarder.SizePolicy = sizePolicy
+		requestProcessor.Forwarder.ClaimCheck = *forcedCombinedClaimCheck
+		requestProcessor.Forwarder.Blobs = blobs
+		requestProcessor.Forwarder.Webhooks = webhooks
+		requestProcessor.Forwarder.Feed = feed
+		requestProcessor.Forwarder.Topic = *forcedCombinedTopic
+		requestProcessor.Forwarder.Whitelists = whitelists
+		requestProcessor.Forwarder.AllowUntypedContent = *allowUntypedContent
+
+		// the endpoints are restricted to the callers the authenticator identifies, when there is one,
+		// and the admin endpoints to the callers with the admin API key
+		auth, err := newAuthenticator(*authMode, *authCallersFile, *authJWKSFile, *authJWTIssuer, *authJWTAudience, time.Duration(*authMaxClockSkew)*time.Second)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid authentication")
+		}
+		auth = withAdminKey(*adminAPIKey, auth)
+
+		// the consumers can be paused independently, e.g. during the maintenance of a dependency
+		consumers := map[string]pausableConsumer{"content": cc, "metadata": mc}
 
 		// Since the health check for all producers and consumers just checks /topics for a response, we pick a producer and a consumer at random
-		routeRequests(port, &requestHandler{requestProcessor: requestProcessor}, NewCombinerHealthcheck(msgProducer, mc.Consumer, &client, *docStoreAPIBaseURL, *publicAnnotationsAPIBaseURL))
+		healthService := NewCombinerHealthcheck(msgSink, mc.Consumer, docStoreAPIClient, *docStoreAPIBaseURL, publicAnnotationsAPIClient, *publicAnnotationsAPIBaseURL)
+		healthService.pausable = consumers
+		routeRequests(port, newRouter(&requestHandler{requestProcessor: requestProcessor}, auth, &webhooksHandler{webhooks: webhooks}, &feedHandler{feed: feed}, &historyHandler{history: history}, &consumersHandler{consumers: consumers}, &whitelistsHandler{whitelists: whitelists}, &configHandler{settings: settings}, healthService))
 	}
 
 	logger.Infof("PostPublicationCombiner is starting with args %v", os.Args)
 
-	err := app.Run(os.Args)
-	if err != nil {
+	if err := app.Run(os.Args); err != nil {
 		logger.WithError(err).Error("App could not start")
 	}
 }
 
-func routeRequests(port *string, requestHandler *requestHandler, healthService *HealthcheckHandler) {
+// newRouter requires the callers the authenticator identifies on every endpoint, but the health, good to go, ping and build info ones.
+func newRouter(requestHandler *requestHandler, auth authenticator, webhooksHandler *webhooksHandler, feedHandler *feedHandler, historyHandler *historyHandler, consumersHandler *consumersHandler, whitelistsHandler *whitelistsHandler, configHandler *configHandler, healthService *HealthcheckHandler) http.Handler {
 	r := http.NewServeMux()
 
 	r.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
@@ -216,6 +827,7 @@ func routeRequests(port *string, requestHandler *requestHandler, healthService *
 		checkKafkaProxyConsumerConnectivity(healthService),
 		checkDocumentStoreAPIHealthcheck(healthService),
 		checkPublicAnnotationsAPIHealthcheck(healthService),
+		checkConsumersNotPaused(healthService),
 	}
 
 	hc := health.TimedHealthCheck{
@@ -229,17 +841,30 @@ func routeRequests(port *string, requestHandler *requestHandler, healthService *
 	}
 
 	r.Handle("/__health", handlers.MethodHandler{"GET": http.HandlerFunc(health.Handler(hc))})
+	r.Handle("/__webhooks", handlers.MethodHandler{"GET": requireCaller(auth, webhooksHandler.getStatus)})
+	// the live feed is a stream, which the logging and metrics handlers don't support
+	r.Handle("/__feed", handlers.MethodHandler{"GET": requireCaller(auth, feedHandler.stream)})
 
 	servicesRouter := mux.NewRouter()
 	servicesRouter.HandleFunc("/{id}", requestHandler.postMessage).Methods("POST")
-
-	var monitoringRouter http.Handler = servicesRouter
+	servicesRouter.HandleFunc("/__history/{id}", historyHandler.getHistory).Methods("GET")
+	servicesRouter.HandleFunc("/__consumers", consumersHandler.getConsumers).Methods("GET")
+	servicesRouter.HandleFunc("/__consumers/{consumer}/pause", requireAdmin(consumersHandler.pause)).Methods("POST")
+	servicesRouter.HandleFunc("/__consumers/{consumer}/resume", requireAdmin(consumersHandler.resume)).Methods("POST")
+	servicesRouter.HandleFunc("/__whitelists", requireAdmin(whitelistsHandler.getWhitelists)).Methods("GET")
+	servicesRouter.HandleFunc("/__whitelists", requireAdmin(whitelistsHandler.putWhitelists)).Methods("PUT")
+	servicesRouter.HandleFunc("/__config", configHandler.getConfig).Methods("GET")
+
+	var monitoringRouter http.Handler = requireCaller(auth, servicesRouter.ServeHTTP)
 	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(logger.Logger(), monitoringRouter)
 	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
 
 	r.Handle("/", monitoringRouter)
+	return r
+}
 
-	server := &http.Server{Addr: ":" + *port, Handler: r}
+func routeRequests(port *string, router http.Handler) {
+	server := &http.Server{Addr: ":" + *port, Handler: router}
 
 	wg := sync.WaitGroup{}
 
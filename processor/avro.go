@@ -0,0 +1,260 @@
+package processor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const (
+	EncodingJSON = "json"
+	EncodingAvro = "avro"
+
+	AvroContentType = "application/avro"
+	SchemaIDHeader  = "Schema-Id"
+	// payloads are prefixed with a magic byte and the schema id, as in the Confluent wire format
+	avroMagicByte    = 0
+	avroHeaderLength = 5
+)
+
+// PayloadEncoder serialises combined messages in a binary format tagged with a schema id.
+type PayloadEncoder interface {
+	Encode(model *CombinedModel) ([]byte, error)
+	ContentType() string
+	SchemaID() int
+}
+
+// ValidateEncoding checks that the encoding is supported, and that it can be wrapped in the output format.
+func ValidateEncoding(encoding string, outputFormat string) error {
+	switch encoding {
+	case EncodingJSON:
+		return nil
+	case EncodingAvro:
+		if outputFormat == OutputFormatCloudEventsStructured {
+			return fmt.Errorf("%v encoding can't be used with the %v output format", encoding, outputFormat)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown encoding %q, expected %q or %q", encoding, EncodingJSON, EncodingAvro)
+}
+
+// NewPayloadEncoder returns the encoder for the encoding, or nil for JSON.
+func NewPayloadEncoder(encoding string, registry SchemaRegistry, subject string) (PayloadEncoder, error) {
+	if encoding != EncodingAvro {
+		return nil, nil
+	}
+	if registry == nil {
+		return nil, errors.New("avro encoding requires a schema registry")
+	}
+	return NewAvroEncoder(registry, subject)
+}
+
+type avroEncoder struct {
+	id    int
+	codec *goavro.Codec
+}
+
+// NewAvroEncoder encodes with the latest schema registered for the subject.
+func NewAvroEncoder(registry SchemaRegistry, subject string) (PayloadEncoder, error) {
+	id, schema, err := registry.Latest(subject)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema with id %d: %v", id, err)
+	}
+	return &avroEncoder{id: id, codec: codec}, nil
+}
+
+func (e *avroEncoder) ContentType() string {
+	return AvroContentType
+}
+
+func (e *avroEncoder) SchemaID() int {
+	return e.id
+}
+
+func (e *avroEncoder) Encode(model *CombinedModel) ([]byte, error) {
+	native, err := avroNativeFromModel(model)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, avroHeaderLength, 1024)
+	buf[0] = avroMagicByte
+	binary.BigEndian.PutUint32(buf[1:avroHeaderLength], uint32(e.id))
+	return e.codec.BinaryFromNative(buf, native)
+}
+
+// AvroDecoder decodes avro payloads, resolving the schema they are tagged with against the registry.
+type AvroDecoder struct {
+	sync.Mutex
+	registry SchemaRegistry
+	codecs   map[int]*goavro.Codec
+}
+
+func NewAvroDecoder(registry SchemaRegistry) *AvroDecoder {
+	return &AvroDecoder{registry: registry, codecs: make(map[int]*goavro.Codec)}
+}
+
+func (d *AvroDecoder) Decode(payload []byte) (CombinedModel, error) {
+	if len(payload) < avroHeaderLength || payload[0] != avroMagicByte {
+		return CombinedModel{}, errors.New("payload isn't tagged with a schema id")
+	}
+
+	codec, err := d.codec(int(binary.BigEndian.Uint32(payload[1:avroHeaderLength])))
+	if err != nil {
+		return CombinedModel{}, err
+	}
+	native, _, err := codec.NativeFromBinary(payload[avroHeaderLength:])
+	if err != nil {
+		return CombinedModel{}, err
+	}
+	return avroNativeToModel(native)
+}
+
+func (d *AvroDecoder) codec(id int) (*goavro.Codec, error) {
+	d.Lock()
+	defer d.Unlock()
+	if codec, ok := d.codecs[id]; ok {
+		return codec, nil
+	}
+
+	schema, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema with id %d: %v", id, err)
+	}
+	d.codecs[id] = codec
+	return codec, nil
+}
+
+func avroNativeFromModel(model *CombinedModel) (map[string]interface{}, error) {
+	native := map[string]interface{}{
+		"schemaVersion":        model.SchemaVersion,
+		"uuid":                 model.UUID,
+		"contentUri":           model.ContentURI,
+		"lastModified":         model.LastModified,
+		"markedDeleted":        model.MarkedDeleted,
+		"lastKnownType":        model.LastKnownType,
+		"lastKnownIdentifiers": nil,
+		"stale":                model.Stale,
+		"content":              nil,
+		"metadata":             nil,
+		"metadataStatus":       model.MetadataStatus,
+	}
+
+	// content and identifiers are free form, they're kept as JSON documents
+	if model.LastKnownIdentifiers != nil {
+		b, err := json.Marshal(model.LastKnownIdentifiers)
+		if err != nil {
+			return nil, err
+		}
+		native["lastKnownIdentifiers"] = goavro.Union("string", string(b))
+	}
+	if model.Content != nil {
+		b, err := json.Marshal(model.Content)
+		if err != nil {
+			return nil, err
+		}
+		native["content"] = goavro.Union("string", string(b))
+	}
+
+	if model.Metadata != nil {
+		annotations := make([]interface{}, 0, len(model.Metadata))
+		for _, a := range model.Metadata {
+			types := make([]interface{}, 0, len(a.Types))
+			for _, t := range a.Types {
+				types = append(types, t)
+			}
+			annotations = append(annotations, map[string]interface{}{
+				"thing": map[string]interface{}{
+					"id":        a.ID,
+					"prefLabel": a.PrefLabel,
+					"types":     types,
+					"predicate": a.Predicate,
+					"apiUrl":    a.ApiUrl,
+				},
+			})
+		}
+		native["metadata"] = goavro.Union("array", annotations)
+	}
+	return native, nil
+}
+
+func avroNativeToModel(native interface{}) (CombinedModel, error) {
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return CombinedModel{}, errors.New("avro payload isn't a record")
+	}
+
+	model := CombinedModel{
+		SchemaVersion:  avroString(record["schemaVersion"]),
+		UUID:           avroString(record["uuid"]),
+		ContentURI:     avroString(record["contentUri"]),
+		LastModified:   avroString(record["lastModified"]),
+		MarkedDeleted:  avroString(record["markedDeleted"]),
+		LastKnownType:  avroString(record["lastKnownType"]),
+		MetadataStatus: avroString(record["metadataStatus"]),
+	}
+	model.Stale, _ = record["stale"].(bool)
+
+	if identifiers, ok := avroUnionValue(record["lastKnownIdentifiers"]).(string); ok {
+		if err := json.Unmarshal([]byte(identifiers), &model.LastKnownIdentifiers); err != nil {
+			return CombinedModel{}, fmt.Errorf("could not unmarshall last known identifiers for uuid=%v, error=%v", model.UUID, err)
+		}
+	}
+
+	if content, ok := avroUnionValue(record["content"]).(string); ok {
+		if err := json.Unmarshal([]byte(content), &model.Content); err != nil {
+			return CombinedModel{}, fmt.Errorf("could not unmarshall content for uuid=%v, error=%v", model.UUID, err)
+		}
+	}
+
+	if annotations, ok := avroUnionValue(record["metadata"]).([]interface{}); ok {
+		model.Metadata = make([]Annotation, 0, len(annotations))
+		for _, a := range annotations {
+			thing, _ := a.(map[string]interface{})["thing"].(map[string]interface{})
+			var types []string
+			for _, t := range thing["types"].([]interface{}) {
+				types = append(types, avroString(t))
+			}
+			model.Metadata = append(model.Metadata, Annotation{Thing{
+				ID:        avroString(thing["id"]),
+				PrefLabel: avroString(thing["prefLabel"]),
+				Types:     types,
+				Predicate: avroString(thing["predicate"]),
+				ApiUrl:    avroString(thing["apiUrl"]),
+			}})
+		}
+	}
+	return model, nil
+}
+
+// avroUnionValue unwraps the {"type": value} maps goavro decodes non null unions to.
+func avroUnionValue(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		for _, value := range m {
+			return value
+		}
+	}
+	return v
+}
+
+func avroString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func schemaIDHeaderValue(e PayloadEncoder) string {
+	return strconv.Itoa(e.SchemaID())
+}
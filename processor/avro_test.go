@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEncoding(t *testing.T) {
+	assert.NoError(t, ValidateEncoding(EncodingJSON, OutputFormatCloudEventsStructured))
+	assert.NoError(t, ValidateEncoding(EncodingAvro, OutputFormatRaw))
+	assert.NoError(t, ValidateEncoding(EncodingAvro, OutputFormatCloudEventsBinary))
+	assert.Error(t, ValidateEncoding(EncodingAvro, OutputFormatCloudEventsStructured))
+	assert.Error(t, ValidateEncoding("protobuf", OutputFormatRaw))
+}
+
+func TestAvroEncoder_RoundTrip(t *testing.T) {
+	registry, err := NewFileSchemaRegistry("schema/avro")
+	assert.NoError(t, err)
+	encoder, err := NewAvroEncoder(registry, DefaultSchemaSubject)
+	assert.NoError(t, err)
+
+	tests := map[string]CombinedModel{
+		"Content with annotations": {
+			SchemaVersion:  CombinedSchemaVersion,
+			UUID:           "some_uuid",
+			ContentURI:     "http://wordpress-article-mapper/content/some_uuid",
+			LastModified:   "2017-03-30T13:09:06.48Z",
+			MarkedDeleted:  "false",
+			Content:        ContentModel{"uuid": "some_uuid", "title": "simple title", "type": "Article"},
+			MetadataStatus: MetadataPresent,
+			Metadata: []Annotation{{Thing{
+				ID:        "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995",
+				PrefLabel: "Barclays",
+				Types:     []string{"http://base-url/core/Thing", "http://base-url/concept/Concept"},
+				Predicate: "http://base-url/about",
+				ApiUrl:    "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995",
+			}}},
+		},
+		"Delete": {
+			SchemaVersion: CombinedSchemaVersion,
+			UUID:          "some_uuid",
+			MarkedDeleted: "true",
+		},
+		"Delete with the last known content": {
+			SchemaVersion:        CombinedSchemaVersion,
+			UUID:                 "some_uuid",
+			MarkedDeleted:        "true",
+			LastKnownType:        "Article",
+			LastKnownIdentifiers: []interface{}{map[string]interface{}{"authority": "http://api.ft.com/system/FTCOM-METHODE", "identifierValue": "some_uuid"}},
+		},
+		"Stale annotations update": {
+			SchemaVersion: CombinedSchemaVersion,
+			UUID:          "some_uuid",
+			Metadata:      []Annotation{},
+			Stale:         true,
+		},
+	}
+
+	decoder := NewAvroDecoder(registry)
+	for name, model := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := encoder.Encode(&model)
+			assert.NoError(t, err)
+			assert.Equal(t, byte(0), b[0])
+			assert.Equal(t, uint32(3), binary.BigEndian.Uint32(b[1:5]))
+
+			decoded, err := decoder.Decode(b)
+			assert.NoError(t, err)
+			assert.Equal(t, model, decoded)
+		})
+	}
+}
+
+func TestAvroDecoder_PreviousSchemaVersion(t *testing.T) {
+	registry, err := NewFileSchemaRegistry("schema/avro")
+	assert.NoError(t, err)
+	schema, err := registry.Schema(1)
+	assert.NoError(t, err)
+	codec, err := goavro.NewCodec(schema)
+	assert.NoError(t, err)
+	v1 := &avroEncoder{id: 1, codec: codec}
+
+	model := CombinedModel{SchemaVersion: "1", UUID: "some_uuid", MarkedDeleted: "true"}
+	b, err := v1.Encode(&model)
+	assert.NoError(t, err)
+
+	decoded, err := NewAvroDecoder(registry).Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, model, decoded)
+}
+
+func TestAvroDecoder_UnknownSchema(t *testing.T) {
+	registry, err := NewFileSchemaRegistry("schema/avro")
+	assert.NoError(t, err)
+
+	_, err = NewAvroDecoder(registry).Decode([]byte{0, 0, 0, 0, 42, 2})
+	assert.Error(t, err)
+	_, err = NewAvroDecoder(registry).Decode([]byte(`{"uuid":"some_uuid"}`))
+	assert.Error(t, err)
+}
+
+func TestForwardMsg_AvroEncoding(t *testing.T) {
+	registry, err := NewFileSchemaRegistry("schema/avro")
+	assert.NoError(t, err)
+	encoder, err := NewPayloadEncoder(EncodingAvro, registry, DefaultSchemaSubject)
+	assert.NoError(t, err)
+
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.Encoder = encoder
+	f.OutputFormat = OutputFormatCloudEventsBinary
+
+	headers := map[string]string{"X-Request-Id": "some-tid1"}
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	assert.NoError(t, f.forwardMsg(headers, &model))
+
+	assert.Len(t, producer.msgs, 1)
+	h := producer.msgs[0].Headers
+	assert.Equal(t, AvroContentType, h["Content-Type"])
+	assert.Equal(t, "3", h[SchemaIDHeader])
+	assert.Equal(t, CombinedSchemaVersion, h[SchemaVersionHeader])
+	assert.Equal(t, "some_uuid", h["ce_subject"])
+
+	decoded, err := NewAvroDecoder(registry).Decode([]byte(producer.msgs[0].Body))
+	assert.NoError(t, err)
+	assert.Equal(t, model, decoded)
+}
+
+func TestNewPayloadEncoder_JSON(t *testing.T) {
+	encoder, err := NewPayloadEncoder(EncodingJSON, nil, DefaultSchemaSubject)
+	assert.NoError(t, err)
+	assert.Nil(t, encoder)
+
+	_, err = NewPayloadEncoder(EncodingAvro, nil, DefaultSchemaSubject)
+	assert.Error(t, err)
+}
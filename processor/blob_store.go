@@ -0,0 +1,90 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const fileBlobScheme = "file://"
+
+// BlobStore keeps the payloads that are too big, or not meant, to be sent through the queue.
+type BlobStore interface {
+	// Put stores the data under the key, and returns the pointer consumers fetch it with.
+	Put(key string, data []byte) (string, error)
+	Get(pointer string) ([]byte, error)
+}
+
+type fileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore stores every blob in its own file under dir, and points to them with file:// URLs.
+func NewFileBlobStore(dir string) (BlobStore, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, fmt.Errorf("could not create blobs directory %v: %v", dir, err)
+	}
+	return fileBlobStore{dir: abs}, nil
+}
+
+func (s fileBlobStore) Put(key string, data []byte) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomically(path, data); err != nil {
+		return "", err
+	}
+	return fileBlobScheme + filepath.ToSlash(path), nil
+}
+
+func (s fileBlobStore) Get(pointer string) ([]byte, error) {
+	if !strings.HasPrefix(pointer, fileBlobScheme) {
+		return nil, fmt.Errorf("unsupported blob pointer %v", pointer)
+	}
+	path := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(pointer, fileBlobScheme)))
+	if !strings.HasPrefix(path, s.dir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("blob pointer %v is outside of the store", pointer)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// path maps every segment of the key to a directory, escaping them so that keys can't point outside of the store.
+func (s fileBlobStore) path(key string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid blob key %v", key)
+		}
+		segments = append(segments, url.PathEscape(segment))
+	}
+	return filepath.Join(append([]string{s.dir}, segments...)...), nil
+}
+
+// writeFileAtomically writes to a temporary file first, so that a crash can't leave a partially written file behind.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
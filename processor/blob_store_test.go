@@ -0,0 +1,51 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileBlobStore_PutGet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileBlobStore(dir)
+	assert.NoError(t, err)
+
+	pointer, err := s.Put("some_uuid/hash", []byte("data"))
+	assert.NoError(t, err)
+	assert.Contains(t, pointer, fileBlobScheme)
+
+	data, err := s.Get(pointer)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	again, err := s.Put("some_uuid/hash", []byte("data"))
+	assert.NoError(t, err)
+	assert.Equal(t, pointer, again)
+}
+
+func TestFileBlobStore_RejectsPathsOutsideOfTheStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileBlobStore(dir)
+	assert.NoError(t, err)
+
+	_, err = s.Put("../some_uuid", []byte("data"))
+	assert.Error(t, err)
+	_, err = s.Put("some_uuid//hash", []byte("data"))
+	assert.Error(t, err)
+
+	_, err = s.Get("file:///etc/passwd")
+	assert.Error(t, err)
+	_, err = s.Get("file://" + dir + "/../passwd")
+	assert.Error(t, err)
+	_, err = s.Get("s3://bucket/key")
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+)
+
+const CombinerReferenceMessageType = "cms-combined-content-reference"
+
+// ReferenceModel is sent instead of the combined message in claim-check mode, or when the message is too big for the queue.
+// The combined message, as it would have been sent, is kept in the blob store the claim check points to.
+type ReferenceModel struct {
+	SchemaVersion   string `json:"schemaVersion"`
+	UUID            string `json:"uuid"`
+	LastModified    string `json:"lastModified"`
+	MarkedDeleted   string `json:"markedDeleted"`
+	ContentHash     string `json:"contentHash"`
+	BlobKey         string `json:"blobKey"`
+	ClaimCheck      string `json:"claimCheck"`
+	ContentType     string `json:"contentType"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	Size            int    `json:"size"`
+}
+
+func (p *Forwarder) forwardReference(headers map[string]string, model *CombinedModel, body []byte) error {
+	if p.Blobs == nil {
+		return newPermanentError(errors.New("claim-check mode requires a blob store"))
+	}
+
+	hash := contentHash(body)
+	// blobs are addressed by content, so that storing the same message again is idempotent
+	key := model.UUID + "/" + hash
+	pointer, err := p.Blobs.Put(key, body)
+	if err != nil {
+		return fmt.Errorf("could not store the combined message for uuid=%v: %v", model.UUID, err)
+	}
+
+	contentType := headers["Content-Type"]
+	if contentType == "" {
+		contentType = ContentType
+	}
+	ref := ReferenceModel{
+		SchemaVersion:   CombinedSchemaVersion,
+		UUID:            model.UUID,
+		LastModified:    model.LastModified,
+		MarkedDeleted:   model.MarkedDeleted,
+		ContentHash:     hash,
+		BlobKey:         key,
+		ClaimCheck:      pointer,
+		ContentType:     contentType,
+		ContentEncoding: headers[ContentEncodingHeader],
+		Size:            len(body),
+	}
+	b, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	return p.MsgProducer.SendMessage(model.UUID, producer.Message{Headers: referenceHeaders(headers), Body: string(b)})
+}
+
+// referenceHeaders keeps the headers of the original message, except for the ones describing its body.
+func referenceHeaders(headers map[string]string) map[string]string {
+	h := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if k == ContentEncodingHeader || k == SchemaIDHeader || strings.HasPrefix(k, cloudEventsHeaderPrefix) {
+			continue
+		}
+		h[k] = v
+	}
+	h["Message-Type"] = CombinerReferenceMessageType
+	h["Content-Type"] = ContentType
+	return h
+}
+
+func contentHash(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
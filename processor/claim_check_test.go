@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardMsg_ClaimCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	blobs, err := NewFileBlobStore(dir)
+	assert.NoError(t, err)
+
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.ClaimCheck = true
+	f.Blobs = blobs
+
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	assert.NoError(t, f.forwardMsg(map[string]string{"X-Request-Id": "some-tid1"}, &model))
+	assert.NoError(t, f.forwardMsg(map[string]string{"X-Request-Id": "some-tid2"}, &model))
+
+	assert.Len(t, producer.msgs, 2)
+	assert.Equal(t, CombinerReferenceMessageType, producer.msgs[0].Headers["Message-Type"])
+	assert.Equal(t, "some-tid1", producer.msgs[0].Headers["X-Request-Id"])
+
+	var ref ReferenceModel
+	assert.NoError(t, json.Unmarshal([]byte(producer.msgs[0].Body), &ref))
+	assert.Equal(t, "some_uuid", ref.UUID)
+	assert.Equal(t, "2017-03-30T13:09:06.48Z", ref.LastModified)
+	assert.Equal(t, "false", ref.MarkedDeleted)
+	assert.Len(t, ref.ContentHash, 64)
+	assert.Equal(t, "some_uuid/"+ref.ContentHash, ref.BlobKey)
+	assert.Empty(t, ref.ContentEncoding)
+
+	stored, err := blobs.Get(ref.ClaimCheck)
+	assert.NoError(t, err)
+	assert.Equal(t, ref.ContentHash, contentHash(stored))
+	var forwarded CombinedModel
+	assert.NoError(t, json.Unmarshal(stored, &forwarded))
+	assert.Equal(t, model, forwarded)
+
+	var again ReferenceModel
+	assert.NoError(t, json.Unmarshal([]byte(producer.msgs[1].Body), &again))
+	assert.Equal(t, ref, again, "the same message should be stored once")
+}
+
+func TestForwardMsg_ClaimCheckWithoutBlobStore(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.ClaimCheck = true
+
+	err := f.forwardMsg(map[string]string{}, &CombinedModel{UUID: "some_uuid", MarkedDeleted: "false"})
+	assert.Error(t, err)
+	assert.True(t, IsPermanentError(err))
+	assert.Empty(t, producer.msgs)
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+
+	uuidlib "github.com/satori/go.uuid"
+)
+
+const (
+	OutputFormatRaw                   = "raw"
+	OutputFormatCloudEventsStructured = "cloudevents-structured"
+	OutputFormatCloudEventsBinary     = "cloudevents-binary"
+
+	CloudEventsSpecVersion        = "1.0"
+	CloudEventsContentType        = "application/cloudevents+json"
+	CloudEventsDefaultSource      = "post-publication-combiner"
+	CloudEventsRequestIDExtension = "requestid"
+	// headers of binary-mode events are prefixed according to the CloudEvents Kafka protocol binding
+	cloudEventsHeaderPrefix = "ce_"
+)
+
+// ValidateOutputFormat checks that the format is one Forwarder can produce.
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case OutputFormatRaw, OutputFormatCloudEventsStructured, OutputFormatCloudEventsBinary:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected one of %q, %q or %q", format, OutputFormatRaw, OutputFormatCloudEventsStructured, OutputFormatCloudEventsBinary)
+}
+
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	RequestID       string          `json:"requestid,omitempty"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// cloudEventID derives the event id from the transaction, the UUID and the lastModified of the content,
+// so that sending the same combined message again produces the same event.
+func cloudEventID(tid string, model *CombinedModel) string {
+	return uuidlib.NewV5(uuidlib.NamespaceURL, tid+"/"+model.UUID+"/"+model.LastModified).String()
+}
+
+// newCloudEvent maps the message headers and the combined message to the CloudEvents context attributes.
+func newCloudEvent(headers map[string]string, model *CombinedModel, dataContentType string, data []byte) cloudEvent {
+	source := headers["Origin-System-Id"]
+	if source == "" {
+		source = CloudEventsDefaultSource
+	}
+
+	return cloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              cloudEventID(headers["X-Request-Id"], model),
+		Type:            headers["Message-Type"],
+		Source:          source,
+		Subject:         model.UUID,
+		Time:            model.LastModified,
+		DataContentType: dataContentType,
+		RequestID:       headers["X-Request-Id"],
+		Data:            data,
+	}
+}
+
+// wrapCloudEvent returns the message body for the given CloudEvents mode, and sets the corresponding headers.
+// Only the binary mode can carry data which isn't JSON.
+func wrapCloudEvent(format string, headers map[string]string, model *CombinedModel, dataContentType string, data []byte) (string, error) {
+	ce := newCloudEvent(headers, model, dataContentType, data)
+
+	if format == OutputFormatCloudEventsStructured {
+		b, err := json.Marshal(ce)
+		if err != nil {
+			return "", err
+		}
+		headers["Content-Type"] = CloudEventsContentType
+		return string(b), nil
+	}
+
+	headers[cloudEventsHeaderPrefix+"specversion"] = ce.SpecVersion
+	headers[cloudEventsHeaderPrefix+"id"] = ce.ID
+	headers[cloudEventsHeaderPrefix+"type"] = ce.Type
+	headers[cloudEventsHeaderPrefix+"source"] = ce.Source
+	headers[cloudEventsHeaderPrefix+"subject"] = ce.Subject
+	if ce.Time != "" {
+		headers[cloudEventsHeaderPrefix+"time"] = ce.Time
+	}
+	if ce.RequestID != "" {
+		headers[cloudEventsHeaderPrefix+CloudEventsRequestIDExtension] = ce.RequestID
+	}
+	headers["Content-Type"] = ce.DataContentType
+	return string(data), nil
+}
@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOutputFormat(t *testing.T) {
+	assert.NoError(t, ValidateOutputFormat(OutputFormatRaw))
+	assert.NoError(t, ValidateOutputFormat(OutputFormatCloudEventsStructured))
+	assert.NoError(t, ValidateOutputFormat(OutputFormatCloudEventsBinary))
+	assert.Error(t, ValidateOutputFormat("avro"))
+	assert.Error(t, ValidateOutputFormat(""))
+}
+
+func TestForwardMsg_CloudEventsStructured(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.OutputFormat = OutputFormatCloudEventsStructured
+
+	headers := map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "http://cmdb.ft.com/systems/pac"}
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	assert.NoError(t, f.forwardMsg(headers, &model))
+
+	assert.Len(t, producer.msgs, 1)
+	assert.Equal(t, "some_uuid", producer.keys[0])
+	assert.Equal(t, CloudEventsContentType, producer.msgs[0].Headers["Content-Type"])
+
+	var ce map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(producer.msgs[0].Body), &ce))
+	assert.Equal(t, "1.0", ce["specversion"])
+	assert.NotEmpty(t, ce["id"])
+	assert.Equal(t, CombinerMessageType, ce["type"])
+	assert.Equal(t, "http://cmdb.ft.com/systems/pac", ce["source"])
+	assert.Equal(t, "some_uuid", ce["subject"])
+	assert.Equal(t, "2017-03-30T13:09:06.48Z", ce["time"])
+	assert.Equal(t, "application/json", ce["datacontenttype"])
+	assert.Equal(t, "some-tid1", ce["requestid"])
+
+	data, err := json.Marshal(ce["data"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"false","content":{"uuid":"some_uuid","type":"Article"},"metadata":null}`, string(data))
+}
+
+func TestForwardMsg_CloudEventsBinary(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.OutputFormat = OutputFormatCloudEventsBinary
+
+	headers := map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": CombinerOrigin}
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	assert.NoError(t, f.forwardMsg(headers, &model))
+
+	assert.Len(t, producer.msgs, 1)
+	h := producer.msgs[0].Headers
+	assert.Equal(t, "1.0", h["ce_specversion"])
+	assert.NotEmpty(t, h["ce_id"])
+	assert.Equal(t, CombinerMessageType, h["ce_type"])
+	assert.Equal(t, CombinerOrigin, h["ce_source"])
+	assert.Equal(t, "some_uuid", h["ce_subject"])
+	assert.Equal(t, "2017-03-30T13:09:06.48Z", h["ce_time"])
+	assert.Equal(t, "some-tid1", h["ce_requestid"])
+	assert.Equal(t, "application/json", h["Content-Type"])
+	assert.JSONEq(t, `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"false","content":{"uuid":"some_uuid","type":"Article"},"metadata":null}`, producer.msgs[0].Body)
+}
+
+func TestWrapCloudEvent_DefaultsForMissingAttributes(t *testing.T) {
+	headers := map[string]string{"Message-Type": CombinerMessageType}
+	model := CombinedModel{UUID: "some_uuid"}
+
+	body, err := wrapCloudEvent(OutputFormatCloudEventsStructured, headers, &model, ContentType, []byte(`{}`))
+	assert.NoError(t, err)
+
+	var ce map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &ce))
+	assert.Equal(t, CloudEventsDefaultSource, ce["source"])
+	assert.NotContains(t, ce, "time")
+	assert.NotContains(t, ce, "requestid")
+
+	headers = map[string]string{"Message-Type": CombinerMessageType}
+	_, err = wrapCloudEvent(OutputFormatCloudEventsBinary, headers, &model, ContentType, []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, CloudEventsDefaultSource, headers["ce_source"])
+	assert.NotContains(t, headers, "ce_time")
+	assert.NotContains(t, headers, "ce_requestid")
+}
+
+func TestWrapCloudEvent_SameIDForTheSameMessage(t *testing.T) {
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z"}
+	send := func(tid string) string {
+		headers := map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": tid}
+		body, err := wrapCloudEvent(OutputFormatCloudEventsStructured, headers, &model, ContentType, []byte(`{}`))
+		assert.NoError(t, err)
+		return body
+	}
+
+	first := send("some-tid1")
+	assert.Equal(t, first, send("some-tid1"), "resending the message should produce the same event")
+
+	var ce1, ce2 map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(first), &ce1))
+	assert.NoError(t, json.Unmarshal([]byte(send("some-tid2")), &ce2))
+	assert.NotEqual(t, ce1["id"], ce2["id"], "other transactions should produce other events")
+
+	model.LastModified = "2017-03-30T13:10:06.48Z"
+	assert.NoError(t, json.Unmarshal([]byte(send("some-tid1")), &ce2))
+	assert.NotEqual(t, ce1["id"], ce2["id"], "other content versions should produce other events")
+}
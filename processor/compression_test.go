@@ -0,0 +1,53 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCompression(t *testing.T) {
+	assert.NoError(t, ValidateCompression(CompressionNone))
+	assert.NoError(t, ValidateCompression(CompressionGzip))
+	assert.NoError(t, ValidateCompression(CompressionZstd))
+	assert.Error(t, ValidateCompression("brotli"))
+	assert.Error(t, ValidateCompression(""))
+}
+
+func TestCompress_RoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"uuid":"some_uuid","type":"Article"}`, 100))
+
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			compressed, err := compress(compression, data)
+			assert.NoError(t, err)
+			if compression != CompressionNone {
+				assert.Less(t, len(compressed), len(data))
+			}
+
+			decompressed, err := Decompress(compression, compressed)
+			assert.NoError(t, err)
+			assert.Equal(t, data, decompressed)
+		})
+	}
+
+	_, err := Decompress("brotli", data)
+	assert.Error(t, err)
+}
+
+func TestForwardMsg_Compression(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.Compression = CompressionGzip
+
+	headers := map[string]string{"X-Request-Id": "some-tid1"}
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	assert.NoError(t, f.forwardMsg(headers, &model))
+
+	assert.Len(t, producer.msgs, 1)
+	assert.Equal(t, CompressionGzip, producer.msgs[0].Headers[ContentEncodingHeader])
+	body, err := Decompress(producer.msgs[0].Headers[ContentEncodingHeader], []byte(producer.msgs[0].Body))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"false","content":{"uuid":"some_uuid","type":"Article"},"metadata":null}`, string(body))
+}
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"encoding/json"
+
+	"github.com/Financial-Times/go-logger"
+)
+
+const ContentNamespace = "content"
+
+// knownContent is what is remembered about the content, so that delete events can be routed like the content they delete.
+type knownContent struct {
+	Type        string      `json:"type"`
+	Identifiers interface{} `json:"identifiers,omitempty"`
+}
+
+// rememberContent records the type and identifiers of the content read for a combined message.
+func rememberContent(state StateStore, model *CombinedModel, tid string) {
+	if state == nil || model.Content == nil || model.Content.getType() == "" {
+		return
+	}
+
+	b, err := json.Marshal(knownContent{Type: model.Content.getType(), Identifiers: model.Content["identifiers"]})
+	if err == nil {
+		err = state.Put(ContentNamespace, model.UUID, b)
+	}
+	if err != nil {
+		logger.WithTransactionID(tid).WithUUID(model.UUID).WithError(err).Warnf("%v - Could not remember the content type.", tid)
+	}
+}
+
+// enrichDelete sets the last known type and identifiers of the deleted content, when known, on a delete message.
+// The content of the delete is left null, as the consumers tell deletes apart by it.
+func enrichDelete(state StateStore, model *CombinedModel, tid string) {
+	if state == nil {
+		return
+	}
+
+	b, ok, err := state.Get(ContentNamespace, model.UUID)
+	if err != nil {
+		logger.WithTransactionID(tid).WithUUID(model.UUID).WithError(err).Warnf("%v - Could not read the last known content type, the delete is forwarded without it.", tid)
+		return
+	}
+	if !ok {
+		logger.WithTransactionID(tid).WithUUID(model.UUID).Infof("%v - Content type of the deleted content is unknown.", tid)
+		return
+	}
+
+	var known knownContent
+	if err := json.Unmarshal(b, &known); err != nil {
+		logger.WithTransactionID(tid).WithUUID(model.UUID).WithError(err).Warnf("%v - Could not read the last known content type, the delete is forwarded without it.", tid)
+		return
+	}
+	model.LastKnownType = known.Type
+	model.LastKnownIdentifiers = known.Identifiers
+}
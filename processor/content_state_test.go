@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessContentMsg_DeleteEventCarriesLastKnownType(t *testing.T) {
+	const uuid = "0cef259d-030d-497d-b4ef-e8fa0ee6db6b"
+	publish, err := createMessage(map[string]string{"X-Request-Id": "some-tid1"}, "./testData/content.json")
+	assert.NoError(t, err)
+	cm := &ContentMessage{}
+	assert.NoError(t, json.Unmarshal([]byte(publish.Body), cm))
+
+	identifiers := []interface{}{map[string]interface{}{"authority": "http://api.ft.com/system/FTCOM-METHODE", "identifierValue": uuid}}
+	dummyDataCombiner := DummyDataCombiner{
+		t:               t,
+		expectedContent: cm.ContentModel,
+		data: CombinedModel{
+			UUID:         uuid,
+			LastModified: "2017-03-30T13:09:06.48Z",
+			Content:      ContentModel{"uuid": uuid, "type": "Article", "identifiers": identifiers},
+		},
+	}
+	producer := &RecordingMsgProducer{}
+	p := &MsgProcessor{
+		config:       MsgProcessorConfig{SupportedContentURIs: []string{"wordpress-article-mapper"}},
+		DataCombiner: dummyDataCombiner,
+		Forwarder:    NewForwarder(producer, []string{"Article"}),
+		State:        NewInMemoryStateStore(10, 0),
+	}
+	assert.NoError(t, p.processContentMsg(publish))
+
+	del, err := createMessage(map[string]string{"X-Request-Id": "some-tid2"}, "./testData/content-null-payload.json")
+	assert.NoError(t, err)
+	assert.NoError(t, p.processContentMsg(del))
+
+	assert.Len(t, producer.msgs, 2)
+	var forwarded CombinedModel
+	assert.NoError(t, json.Unmarshal([]byte(producer.msgs[1].Body), &forwarded))
+	assert.Equal(t, "true", forwarded.MarkedDeleted)
+	assert.Nil(t, forwarded.Content, "deletes should keep a null content")
+	assert.Equal(t, "Article", forwarded.LastKnownType)
+	assert.Equal(t, identifiers, forwarded.LastKnownIdentifiers)
+}
+
+func TestProcessContentMsg_DeleteEventIsFilteredByLastKnownType(t *testing.T) {
+	const uuid = "0cef259d-030d-497d-b4ef-e8fa0ee6db6b"
+	state := NewInMemoryStateStore(10, 0)
+	rememberContent(state, &CombinedModel{UUID: uuid, Content: ContentModel{"uuid": uuid, "type": "Content"}}, "some-tid1")
+
+	producer := &RecordingMsgProducer{}
+	p := &MsgProcessor{
+		config:    MsgProcessorConfig{SupportedContentURIs: []string{"wordpress-article-mapper"}},
+		Forwarder: NewForwarder(producer, []string{"Article"}),
+		State:     state,
+	}
+
+	del, err := createMessage(map[string]string{"X-Request-Id": "some-tid2"}, "./testData/content-null-payload.json")
+	assert.NoError(t, err)
+	assert.NoError(t, p.processContentMsg(del))
+	assert.Empty(t, producer.msgs, "deletes of unsupported content types should be filtered out")
+}
+
+func TestEnrichDelete_UnknownContent(t *testing.T) {
+	model := CombinedModel{UUID: "some_uuid", MarkedDeleted: "true"}
+
+	enrichDelete(nil, &model, "some-tid1")
+	assert.Empty(t, model.LastKnownType)
+
+	enrichDelete(NewInMemoryStateStore(10, 0), &model, "some-tid1")
+	assert.Empty(t, model.LastKnownType)
+
+	enrichDelete(&failingStateStore{}, &model, "some-tid1")
+	assert.Empty(t, model.LastKnownType, "deletes should be forwarded when the state can't be read")
+	assert.Nil(t, model.Content)
+}
+
+func TestRequestProcessor_RemembersContentType(t *testing.T) {
+	state := NewInMemoryStateStore(10, 0)
+	p := &RequestProcessor{
+		DataCombiner: DummyDataCombiner{t: t, expectedUUID: "some_uuid", data: CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}},
+		Forwarder:    NewForwarder(&RecordingMsgProducer{}, []string{"Article"}),
+		State:        state,
+	}
+	assert.NoError(t, p.ForceMessagePublish("some_uuid", "some-tid1", ""))
+
+	model := CombinedModel{UUID: "some_uuid", MarkedDeleted: "true"}
+	enrichDelete(state, &model, "some-tid2")
+	assert.Equal(t, "Article", model.LastKnownType)
+}
+
+type failingStateStore struct{}
+
+func (s *failingStateStore) Get(namespace string, uuid string) ([]byte, bool, error) {
+	return nil, false, errors.New("some error")
+}
+
+func (s *failingStateStore) Put(namespace string, uuid string, value []byte) error {
+	return errors.New("some error")
+}
+
+func (s *failingStateStore) Delete(namespace string, uuid string) error {
+	return errors.New("some error")
+}
+
+func (s *failingStateStore) Close() error {
+	return nil
+}
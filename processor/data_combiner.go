@@ -9,6 +9,13 @@ import (
 	"github.com/Financial-Times/post-publication-combiner/v2/utils"
 )
 
+const (
+	MetadataPresent     = "present"
+	MetadataEmpty       = "empty"
+	MetadataNotFound    = "not-found"
+	MetadataFetchFailed = "fetch-failed"
+)
+
 type DataCombinerI interface {
 	GetCombinedModelForContent(content ContentModel) (CombinedModel, error)
 	GetCombinedModelForAnnotations(metadata AnnotationsMessage) (CombinedModel, error)
@@ -33,9 +40,10 @@ type dataRetriever struct {
 	client  utils.Client
 }
 
-func NewDataCombiner(docStoreApiUrl utils.ApiURL, annApiUrl utils.ApiURL, c utils.Client) DataCombinerI {
-	var cRetriever contentRetrieverI = dataRetriever{docStoreApiUrl, c}
-	var mRetriever metadataRetrieverI = dataRetriever{annApiUrl, c}
+// NewDataCombiner retrieves the content and the metadata with their own clients, so that they don't share connections.
+func NewDataCombiner(docStoreApiUrl utils.ApiURL, annApiUrl utils.ApiURL, docStoreClient utils.Client, annClient utils.Client) DataCombinerI {
+	var cRetriever contentRetrieverI = dataRetriever{docStoreApiUrl, docStoreClient}
+	var mRetriever metadataRetrieverI = dataRetriever{annApiUrl, annClient}
 
 	return DataCombiner{
 		ContentRetriever:  cRetriever,
@@ -51,14 +59,15 @@ func (dc DataCombiner) GetCombinedModelForContent(content ContentModel) (Combine
 
 	ann, err := dc.MetadataRetriever.getAnnotations(content.getUUID())
 	if err != nil {
-		return CombinedModel{}, err
+		return CombinedModel{}, newMetadataFetchError(content.getUUID(), content, err)
 	}
 
 	return CombinedModel{
-		UUID:         content.getUUID(),
-		Content:      content,
-		Metadata:     ann,
-		LastModified: content.getLastModified(),
+		UUID:           content.getUUID(),
+		Content:        content,
+		Metadata:       ann,
+		MetadataStatus: metadataStatus(content, ann),
+		LastModified:   content.getLastModified(),
 	}, nil
 }
 
@@ -83,17 +92,31 @@ func (dc DataCombiner) GetCombinedModel(uuid string) (CombinedModel, error) {
 	// Get annotations
 	annotations, err := dc.MetadataRetriever.getAnnotations(uuid)
 	if err != nil {
-		return CombinedModel{}, err
+		return CombinedModel{}, newMetadataFetchError(uuid, content, err)
 	}
 
 	return CombinedModel{
-		UUID:         uuid,
-		Content:      content,
-		Metadata:     annotations,
-		LastModified: content.getLastModified(),
+		UUID:           uuid,
+		Content:        content,
+		Metadata:       annotations,
+		MetadataStatus: metadataStatus(content, annotations),
+		LastModified:   content.getLastModified(),
 	}, nil
 }
 
+// metadataStatus tells apart content without annotations from content unknown to the combiner.
+// public-annotations-api responds 404 for content without annotations, for which getAnnotations returns nil,
+// so only the content being missing from the document store too makes it not-found.
+func metadataStatus(content ContentModel, annotations []Annotation) string {
+	switch {
+	case len(annotations) > 0:
+		return MetadataPresent
+	case content == nil:
+		return MetadataNotFound
+	}
+	return MetadataEmpty
+}
+
 func (dr dataRetriever) getAnnotations(uuid string) ([]Annotation, error) {
 
 	var ann []Annotation
@@ -112,6 +135,7 @@ func (dr dataRetriever) getAnnotations(uuid string) ([]Annotation, error) {
 	if err := json.Unmarshal(b, &things); err != nil {
 		return ann, fmt.Errorf("could not unmarshall annotations for content with uuid=%v, error=%v", uuid, err.Error())
 	}
+	ann = make([]Annotation, 0, len(things))
 	for _, t := range things {
 		ann = append(ann, Annotation{t})
 	}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
@@ -107,6 +108,7 @@ func TestGetCombinedModelForContent(t *testing.T) {
 					"mainImage":          "2934de46-5240-4c7d-8576-f12ae12e4a37",
 					"publishReference":   "tid_unique_reference",
 				},
+				MetadataStatus: MetadataPresent,
 				Metadata: []Annotation{
 					{
 						Thing: Thing{
@@ -200,6 +202,7 @@ func TestGetCombinedModelForAnnotations(t *testing.T) {
 					"title": "title",
 					"body":  "body",
 				},
+				MetadataStatus: MetadataPresent,
 				Metadata: []Annotation{
 					{Thing{
 						ID:        "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995",
@@ -254,6 +257,7 @@ func TestGetCombinedModelForAnnotations(t *testing.T) {
 						},
 					},
 				},
+				MetadataStatus: MetadataPresent,
 				Metadata: []Annotation{
 					{Thing{
 						ID:        "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995",
@@ -305,6 +309,16 @@ func TestGetAnnotations(t *testing.T) {
 			[]Annotation(nil), //empty value for a slice
 			nil,
 		},
+		{
+			"some_uuid",
+			utils.ApiURL{BaseURL: "some_host", Endpoint: "some_endpoint"},
+			dummyClient{
+				statusCode: http.StatusOK,
+				body:       `[]`,
+			},
+			[]Annotation{},
+			nil,
+		},
 		{
 			"some_uuid",
 			utils.ApiURL{"some_host", "some_endpoint"},
@@ -499,6 +513,64 @@ func TestGetContent(t *testing.T) {
 	}
 }
 
+func TestMetadataStatus(t *testing.T) {
+	content := ContentModel{"uuid": "some_uuid"}
+	assert.Equal(t, MetadataEmpty, metadataStatus(content, nil), "public-annotations-api responds 404 for content without annotations")
+	assert.Equal(t, MetadataEmpty, metadataStatus(content, []Annotation{}))
+	assert.Equal(t, MetadataNotFound, metadataStatus(nil, nil))
+	assert.Equal(t, MetadataPresent, metadataStatus(content, []Annotation{{Thing{ID: "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}}))
+	assert.Equal(t, MetadataPresent, metadataStatus(nil, []Annotation{{Thing{ID: "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}}))
+}
+
+func TestGetCombinedModel_MetadataStatus(t *testing.T) {
+	docStore := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/content/known_uuid", "/content/annotated_uuid":
+			w.Write([]byte(`{"uuid":"` + strings.TrimPrefix(r.URL.Path, "/content/") + `","type":"Article"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer docStore.Close()
+	// public-annotations-api responds 404 without a body for content without annotations, whether it is known or not
+	annotationsAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/content/annotated_uuid/annotations" {
+			w.Write([]byte(`[{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer annotationsAPI.Close()
+
+	combiner := NewDataCombiner(
+		utils.ApiURL{BaseURL: docStore.URL, Endpoint: "/content/{uuid}"},
+		utils.ApiURL{BaseURL: annotationsAPI.URL, Endpoint: "/content/{uuid}/annotations"},
+		http.DefaultClient, http.DefaultClient).(DataCombiner)
+
+	tests := map[string]struct {
+		uuid      string
+		expStatus string
+	}{
+		"Annotations":                 {"annotated_uuid", MetadataPresent},
+		"Annotations removed":         {"known_uuid", MetadataEmpty},
+		"Unknown to the combiner yet": {"unknown_uuid", MetadataNotFound},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := combiner.GetCombinedModel(test.uuid)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expStatus, m.MetadataStatus)
+
+			if m.Content != nil {
+				m, err = combiner.GetCombinedModelForContent(m.Content)
+				assert.NoError(t, err)
+				assert.Equal(t, test.expStatus, m.MetadataStatus)
+			}
+		})
+	}
+}
+
 type dummyClient struct {
 	statusCode int
 	body       string
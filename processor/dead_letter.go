@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"errors"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+)
+
+const (
+	DeadLetterReasonHeader      = "X-Dead-Letter-Reason"
+	DeadLetterSourceTopicHeader = "X-Dead-Letter-Source-Topic"
+)
+
+// permanentError marks processing failures that redelivering the same message can't fix.
+type permanentError struct {
+	error
+}
+
+func newPermanentError(err error) error {
+	return permanentError{err}
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+func IsPermanentError(err error) bool {
+	var pErr permanentError
+	return errors.As(err, &pErr)
+}
+
+// DeadLetterQueue parks messages that could not be processed.
+// Without a producer the message is only logged, which still counts as explicitly dead-lettered.
+type DeadLetterQueue struct {
+	MsgProducer producer.MessageProducer
+}
+
+func NewDeadLetterQueue(msgProducer producer.MessageProducer) DeadLetterQueue {
+	return DeadLetterQueue{MsgProducer: msgProducer}
+}
+
+func (q DeadLetterQueue) Send(sourceTopic string, m consumer.Message, reason error) error {
+	tid := m.Headers["X-Request-Id"]
+
+	if q.MsgProducer == nil {
+		logger.WithTransactionID(tid).WithError(reason).Errorf("%v - Dead-lettered message from %v: %v", tid, sourceTopic, m.Body)
+		return nil
+	}
+
+	headers := make(map[string]string, len(m.Headers)+2)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[DeadLetterSourceTopicHeader] = sourceTopic
+	if reason != nil {
+		headers[DeadLetterReasonHeader] = reason.Error()
+	}
+
+	if err := q.MsgProducer.SendMessage(tid, producer.Message{Headers: headers, Body: m.Body}); err != nil {
+		return err
+	}
+	logger.WithTransactionID(tid).WithError(reason).Errorf("%v - Dead-lettered message from %v", tid, sourceTopic)
+	return nil
+}
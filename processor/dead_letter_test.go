@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	testLogger "github.com/Financial-Times/go-logger/test"
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterQueueSend(t *testing.T) {
+	dlp := &DummyDeadLetterProducer{}
+	q := NewDeadLetterQueue(dlp)
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "some-origin"}, Body: "body"}
+	err := q.Send("PostPublicationEvents", m, errors.New("some error"))
+	assert.NoError(t, err)
+
+	assert.Len(t, dlp.msgs, 1)
+	assert.Equal(t, "body", dlp.msgs[0].Body)
+	assert.Equal(t, "some-origin", dlp.msgs[0].Headers["Origin-System-Id"])
+	assert.Equal(t, "PostPublicationEvents", dlp.msgs[0].Headers[DeadLetterSourceTopicHeader])
+	assert.Equal(t, "some error", dlp.msgs[0].Headers[DeadLetterReasonHeader])
+	assert.NotContains(t, m.Headers, DeadLetterReasonHeader, "the consumed message headers shouldn't be modified")
+}
+
+func TestDeadLetterQueueSend_ProducerError(t *testing.T) {
+	q := NewDeadLetterQueue(&DummyDeadLetterProducer{err: errors.New("producer error")})
+
+	err := q.Send("PostPublicationEvents", consumer.Message{Headers: map[string]string{}}, errors.New("some error"))
+	assert.EqualError(t, err, "producer error")
+}
+
+func TestDeadLetterQueueSend_WithoutProducerLogs(t *testing.T) {
+	q := NewDeadLetterQueue(nil)
+
+	hook := testLogger.NewTestHook("combiner")
+	err := q.Send("PostPublicationEvents", consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}, errors.New("some error"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "error", hook.LastEntry().Level.String())
+	assert.Contains(t, hook.LastEntry().Message, fmt.Sprintf("%v - Dead-lettered message from %v: %v", "some-tid1", "PostPublicationEvents", "body"))
+}
+
+func TestIsPermanentError(t *testing.T) {
+	assert.True(t, IsPermanentError(newPermanentError(errors.New("some error"))))
+	assert.True(t, IsPermanentError(fmt.Errorf("wrapped: %w", newPermanentError(errors.New("some error")))))
+	assert.False(t, IsPermanentError(errors.New("some error")))
+	assert.False(t, IsPermanentError(nil))
+}
+
+type DummyDeadLetterProducer struct {
+	sync.Mutex
+	msgs []producer.Message
+	err  error
+}
+
+func (p *DummyDeadLetterProducer) SendMessage(uuid string, m producer.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.msgs = append(p.msgs, m)
+	return nil
+}
+
+func (p *DummyDeadLetterProducer) ConnectivityCheck() (string, error) {
+	return "", nil
+}
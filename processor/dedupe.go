@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/rcrowley/go-metrics"
+)
+
+const UnchangedSkippedMetric = "combiner.unchanged.skipped"
+
+var UnchangedContentError = errors.New("unchanged content") // used when the combined message is the same as the last one forwarded for the uuid
+
+// HashStore records the hash of the last combined message forwarded per UUID.
+type HashStore interface {
+	Get(uuid string) (string, bool)
+	Set(uuid string, hash string)
+}
+
+// canonicalHash hashes the message as it is forwarded. Map keys are sorted when marshalling, so equal messages hash the same.
+func canonicalHash(model *CombinedModel) (string, error) {
+	m := *model
+	m.SchemaVersion = CombinedSchemaVersion
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func countUnchangedSkipped() {
+	metrics.GetOrRegisterCounter(UnchangedSkippedMetric, metrics.DefaultRegistry).Inc(1)
+}
+
+type stateHashStore struct {
+	state StateStore
+}
+
+// NewHashStore keeps the hashes in the state store, so that they survive restarts with a persistent store.
+func NewHashStore(state StateStore) HashStore {
+	return stateHashStore{state: state}
+}
+
+func (s stateHashStore) Get(uuid string) (string, bool) {
+	value, ok, err := s.state.Get(HashesNamespace, uuid)
+	if err != nil {
+		logger.WithField("uuid", uuid).WithError(err).Error("Could not load content hash")
+		return "", false
+	}
+	return string(value), ok
+}
+
+func (s stateHashStore) Set(uuid string, hash string) {
+	if err := s.state.Put(HashesNamespace, uuid, []byte(hash)); err != nil {
+		logger.WithField("uuid", uuid).WithError(err).Error("Could not persist content hash")
+	}
+}
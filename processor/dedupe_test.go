@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalHash(t *testing.T) {
+	a := CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "title": "title", "type": "Article"}}
+	b := CombinedModel{UUID: "some_uuid", Content: ContentModel{"type": "Article", "title": "title", "uuid": "some_uuid"}, SchemaVersion: CombinedSchemaVersion}
+	c := CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "title": "new title", "type": "Article"}}
+
+	hashA, err := canonicalHash(&a)
+	assert.NoError(t, err)
+	hashB, err := canonicalHash(&b)
+	assert.NoError(t, err)
+	hashC, err := canonicalHash(&c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, hashA, hashB)
+	assert.NotEqual(t, hashA, hashC)
+}
+
+func TestHashStore(t *testing.T) {
+	state := NewInMemoryStateStore(10, 0)
+	s := NewHashStore(state)
+	s.Set("uuid1", "hash1")
+	s.Set("uuid1", "hash2")
+
+	hash, ok := s.Get("uuid1")
+	assert.True(t, ok)
+	assert.Equal(t, "hash2", hash)
+	_, ok = s.Get("uuid2")
+	assert.False(t, ok)
+
+	restarted := NewHashStore(state)
+	hash, ok = restarted.Get("uuid1")
+	assert.True(t, ok, "the hashes should be read from the state store")
+	assert.Equal(t, "hash2", hash)
+}
+
+func TestFilterAndForwardMsg_SkipsUnchangedMessages(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.Hashes = NewHashStore(NewInMemoryStateStore(10, 0))
+	f.SkipUnchanged = true
+	skipped := metrics.GetOrRegisterCounter(UnchangedSkippedMetric, metrics.DefaultRegistry)
+	before := skipped.Count()
+
+	model := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:06.48Z", Content: ContentModel{"type": "Article"}, Metadata: []Annotation{}}
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &model, "some-tid1"))
+
+	same := model
+	assert.Equal(t, UnchangedContentError, f.filterAndForwardMsg(map[string]string{}, &same, "some-tid2"))
+	assert.Equal(t, before+1, skipped.Count())
+
+	changed := model
+	changed.Metadata = []Annotation{{Thing{ID: "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}}
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &changed, "some-tid3"))
+	assert.Len(t, producer.msgs, 2)
+}
+
+func TestFilterAndForwardMsg_RecordsHashesWithoutSkipping(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.Hashes = NewHashStore(NewInMemoryStateStore(10, 0))
+
+	model := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:06.48Z", Content: ContentModel{"type": "Article"}}
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &model, "some-tid1"))
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &model, "some-tid2"))
+	assert.Len(t, producer.msgs, 2)
+
+	_, ok := f.Hashes.Get("uuid1")
+	assert.True(t, ok)
+}
@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	LimitGlobal      = "global rate"
+	LimitCaller      = "caller rate"
+	LimitConcurrency = "concurrency"
+
+	concurrencyRetryAfter = time.Second
+)
+
+// RateLimitError rejects the force requests over the limits, which can be retried after RetryAfter.
+type RateLimitError struct {
+	Limit      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v limit reached, retry after %v", e.Limit, e.RetryAfter)
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate tokens per second.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// wait returns how long until a token is available, zero when there is one.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// ForceLimits limits the force requests, globally and per caller, with token buckets, and caps the force requests processed at once.
+// Limits set to zero are disabled. The force requests without a caller share the same caller limit.
+type ForceLimits struct {
+	sync.Mutex
+	global      *tokenBucket
+	callerRate  int
+	callerBurst int
+	callers     map[string]*tokenBucket
+	concurrent  chan struct{}
+	now         func() time.Time
+}
+
+func NewForceLimits(rate int, burst int, callerRate int, callerBurst int, maxConcurrent int) *ForceLimits {
+	l := &ForceLimits{callerRate: callerRate, callerBurst: callerBurst, callers: map[string]*tokenBucket{}, now: time.Now}
+	if rate > 0 {
+		l.global = newTokenBucket(rate, burst, l.now())
+	}
+	if maxConcurrent > 0 {
+		l.concurrent = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// Acquire admits a force request of the caller, or returns a RateLimitError. Admitted requests must call release once processed.
+func (l *ForceLimits) Acquire(caller string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	release = func() {}
+	if l.concurrent != nil {
+		select {
+		case l.concurrent <- struct{}{}:
+			release = func() { <-l.concurrent }
+		default:
+			return nil, &RateLimitError{Limit: LimitConcurrency, RetryAfter: concurrencyRetryAfter}
+		}
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	var buckets []*tokenBucket
+	if l.callerRate > 0 {
+		b, ok := l.callers[caller]
+		if !ok {
+			b = newTokenBucket(l.callerRate, l.callerBurst, now)
+			l.callers[caller] = b
+		}
+		if wait := b.wait(now); wait > 0 {
+			release()
+			return nil, &RateLimitError{Limit: LimitCaller, RetryAfter: wait}
+		}
+		buckets = append(buckets, b)
+	}
+	if l.global != nil {
+		if wait := l.global.wait(now); wait > 0 {
+			release()
+			return nil, &RateLimitError{Limit: LimitGlobal, RetryAfter: wait}
+		}
+		buckets = append(buckets, l.global)
+	}
+	// the tokens are only taken once all the limits admitted the request
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return release, nil
+}
@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForceLimits_RateLimitsPerCaller(t *testing.T) {
+	now := time.Date(2017, 3, 30, 13, 9, 6, 0, time.UTC)
+	l := NewForceLimits(0, 0, 2, 2, 0)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire("reindexer")
+		assert.NoError(t, err)
+		release()
+	}
+	_, err := l.Acquire("reindexer")
+	assert.Equal(t, &RateLimitError{Limit: LimitCaller, RetryAfter: 500 * time.Millisecond}, err)
+
+	// other callers have their own limit
+	_, err = l.Acquire("other")
+	assert.NoError(t, err)
+
+	now = now.Add(500 * time.Millisecond)
+	_, err = l.Acquire("reindexer")
+	assert.NoError(t, err)
+}
+
+func TestForceLimits_GlobalRateLimit(t *testing.T) {
+	now := time.Date(2017, 3, 30, 13, 9, 6, 0, time.UTC)
+	l := NewForceLimits(1, 1, 10, 10, 0)
+	l.now = func() time.Time { return now }
+	l.global.last = now
+
+	_, err := l.Acquire("reindexer")
+	assert.NoError(t, err)
+	_, err = l.Acquire("other")
+	assert.Equal(t, &RateLimitError{Limit: LimitGlobal, RetryAfter: time.Second}, err)
+
+	// rejected requests don't use the tokens of the caller
+	assert.Equal(t, float64(10), l.callers["other"].tokens)
+}
+
+func TestForceLimits_ConcurrencyCap(t *testing.T) {
+	l := NewForceLimits(0, 0, 0, 0, 1)
+
+	release, err := l.Acquire("reindexer")
+	assert.NoError(t, err)
+	_, err = l.Acquire("reindexer")
+	assert.Equal(t, &RateLimitError{Limit: LimitConcurrency, RetryAfter: time.Second}, err)
+
+	release()
+	_, err = l.Acquire("reindexer")
+	assert.NoError(t, err)
+}
+
+func TestForceMessageRateLimited(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	p := &RequestProcessor{DataCombiner: DummyDataCombiner{t: t}, Forwarder: NewForwarder(producer, []string{"Article"}), Limits: NewForceLimits(0, 0, 0, 0, 1)}
+	release, err := p.Limits.Acquire("reindexer")
+	assert.NoError(t, err)
+	defer release()
+
+	err = p.ForceMessagePublish("some_uuid", "some-tid", "reindexer")
+	assert.IsType(t, &RateLimitError{}, err)
+	assert.Empty(t, producer.msgs)
+}
@@ -11,14 +11,44 @@ const (
 )
 
 type Forwarder struct {
-	MsgProducer           producer.MessageProducer
+	MsgProducer           Sink
 	SupportedContentTypes []string
+	// AllowUntypedContent forwards the content without a type, whatever the supported content types
+	AllowUntypedContent bool
+	Watermarks          WatermarkStore
+	// OutputFormat is either the raw combined message, or the combined message wrapped in a CloudEvents envelope
+	OutputFormat string
+	// Encoder serialises the combined message in a binary format, messages are JSON encoded when it's nil
+	Encoder PayloadEncoder
+	// Compression is applied to the message body, and named in the Content-Encoding header
+	Compression string
+	SizePolicy  SizePolicy
+	// ClaimCheck sends every message as a reference to the combined message kept in Blobs
+	ClaimCheck bool
+	// Blobs keeps the messages sent as references
+	Blobs BlobStore
+	// Hashes records the last combined message forwarded per UUID, and SkipUnchanged stops forwarding the same message again
+	Hashes        HashStore
+	SkipUnchanged bool
+	// Webhooks are notified of the messages forwarded, and Feed streams them, along with the Topic they're sent to
+	Webhooks *Webhooks
+	Feed     *LiveFeed
+	Topic    string
+	// Whitelists replaces SupportedContentTypes when set, so that they can change at runtime
+	Whitelists *Whitelists
+	ordering   *orderingGuard
 }
 
-func NewForwarder(msgProducer producer.MessageProducer, supportedContentTypes []string) Forwarder {
+func NewForwarder(msgProducer Sink, supportedContentTypes []string) Forwarder {
 	return Forwarder{
 		MsgProducer:           msgProducer,
 		SupportedContentTypes: supportedContentTypes,
+		AllowUntypedContent:   true,
+		Watermarks:            NewWatermarkStore(NewInMemoryStateStore(DefaultWatermarkCapacity, 0)),
+		OutputFormat:          OutputFormatRaw,
+		Compression:           CompressionNone,
+		SizePolicy:            SizePolicy{Action: SizeActionDeadLetter},
+		ordering:              newOrderingGuard(),
 	}
 }
 
@@ -30,36 +60,135 @@ func NewProducerConfig(proxyAddress string, topic string, routingHeader string)
 	}
 }
 
+// filterAndForwardMsg leaves the headers as they are: the ones of the combined message are set on a copy,
+// so that a message redelivered, retried or dead-lettered after a failure keeps its own headers.
+// The retry attempt is only meant for the combiner, and isn't forwarded.
 func (p *Forwarder) filterAndForwardMsg(headers map[string]string, combinedMSG *CombinedModel, tid string) error {
+	headers = cloneHeaders(headers)
+	delete(headers, RetryAttemptHeader)
 
-	if combinedMSG.Content != nil && !isTypeAllowed(p.SupportedContentTypes, combinedMSG.Content.getType()) {
-		logger.WithTransactionID(tid).Infof("%v - Skipped unsupported content with type: %v", tid, combinedMSG.Content.getType())
+	if contentType, ok := combinedMSG.contentType(); ok && !(contentType == "" && p.AllowUntypedContent) && !isTypeAllowed(p.supportedContentTypes(), contentType) {
+		logger.WithTransactionID(tid).Infof("%v - Skipped unsupported content with type: %v", tid, contentType)
 		return InvalidContentTypeError
 	}
 
+	// keep the output ordered per UUID: messages are keyed by UUID, so they land on the same partition,
+	// and a combined message older than one already forwarded would overwrite newer data downstream.
+	// Messages explicitly marked as stale are forwarded, as the consumers are expected to handle them.
+	if p.ordering != nil {
+		unlock := p.ordering.lock(combinedMSG.UUID)
+		defer unlock()
+	}
+	if p.Watermarks != nil && !combinedMSG.Stale {
+		if isOlderThanWatermark(p.Watermarks, combinedMSG.UUID, combinedMSG.LastModified) {
+			logger.WithTransactionID(tid).WithUUID(combinedMSG.UUID).Warnf("%v - Skipped stale combined message with lastModified: %v", tid, combinedMSG.LastModified)
+			return StaleContentError
+		}
+	}
+
+	// many annotations updates don't change the combined message, these are not forwarded again
+	var hash string
+	if p.Hashes != nil {
+		var err error
+		if hash, err = canonicalHash(combinedMSG); err != nil {
+			return err
+		}
+		if last, ok := p.Hashes.Get(combinedMSG.UUID); ok && last == hash && p.SkipUnchanged {
+			logger.WithTransactionID(tid).WithUUID(combinedMSG.UUID).Infof("%v - Skipped unchanged combined message", tid)
+			countUnchangedSkipped()
+			return UnchangedContentError
+		}
+	}
+
 	//forward data
 	err := p.forwardMsg(headers, combinedMSG)
 	if err != nil {
 		logger.WithTransactionID(tid).WithError(err).Errorf("%v - Error sending transformed message to queue.", tid)
 		return err
 	}
+	if p.Watermarks != nil {
+		advanceWatermark(p.Watermarks, combinedMSG.UUID, combinedMSG.LastModified)
+	}
+	if p.Hashes != nil {
+		p.Hashes.Set(combinedMSG.UUID, hash)
+	}
+	if p.Webhooks != nil {
+		p.Webhooks.Notify(headers, combinedMSG)
+	}
+	if p.Feed != nil {
+		p.Feed.Publish(p.Topic, headers, combinedMSG)
+	}
 	logger.WithTransactionID(tid).Infof("%v - Mapped and sent for uuid: %v", tid, combinedMSG.UUID)
 	return nil
 }
 
+func (p *Forwarder) supportedContentTypes() []string {
+	if p.Whitelists != nil {
+		return p.Whitelists.Get().ContentTypes
+	}
+	return p.SupportedContentTypes
+}
+
 func isTypeAllowed(allowedTypes []string, value string) bool {
 	return contains(allowedTypes, value)
 }
 
 func (p *Forwarder) forwardMsg(headers map[string]string, model *CombinedModel) error {
 	// marshall message
+	model.SchemaVersion = CombinedSchemaVersion
 	b, err := json.Marshal(model)
 	if err != nil {
 		return err
 	}
+	// consumers rely on the schema contract, messages breaking it are rejected instead of forwarded
+	if err := validateCombinedMessage(b); err != nil {
+		return err
+	}
 	// add special message type
 	headers["Message-Type"] = CombinerMessageType
-	return p.MsgProducer.SendMessage(model.UUID, producer.Message{Headers: headers, Body: string(b)})
+	headers[SchemaVersionHeader] = CombinedSchemaVersion
+
+	dataContentType := ContentType
+	if p.Encoder != nil {
+		if b, err = p.Encoder.Encode(model); err != nil {
+			return newPermanentError(err)
+		}
+		dataContentType = p.Encoder.ContentType()
+		headers["Content-Type"] = dataContentType
+		headers[SchemaIDHeader] = schemaIDHeaderValue(p.Encoder)
+	}
+
+	body := string(b)
+	if p.OutputFormat == OutputFormatCloudEventsStructured || p.OutputFormat == OutputFormatCloudEventsBinary {
+		if body, err = wrapCloudEvent(p.OutputFormat, headers, model, dataContentType, b); err != nil {
+			return err
+		}
+	}
+	if p.Compression != "" && p.Compression != CompressionNone {
+		compressed, err := compress(p.Compression, []byte(body))
+		if err != nil {
+			return err
+		}
+		body = string(compressed)
+		headers[ContentEncodingHeader] = p.Compression
+	}
+	oversized, err := p.checkSize(model, len(body))
+	if err != nil {
+		return err
+	}
+	if oversized || p.ClaimCheck {
+		return p.forwardReference(headers, model, []byte(body))
+	}
+	// the UUID is the partition key, which keeps all the messages for a piece of content in order
+	return p.MsgProducer.SendMessage(model.UUID, producer.Message{Headers: headers, Body: body})
+}
+
+func cloneHeaders(headers map[string]string) map[string]string {
+	clone := make(map[string]string, len(headers))
+	for k, v := range headers {
+		clone[k] = v
+	}
+	return clone
 }
 
 func contains(array []string, element string) bool {
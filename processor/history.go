@@ -0,0 +1,192 @@
+package processor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+)
+
+const (
+	DecisionForwarded = "forwarded"
+	DecisionSkipped   = "skipped"
+	DecisionFailed    = "failed"
+
+	DefaultHistoryCapacity     = 10000
+	DefaultHistorySaveInterval = time.Minute
+	// ForceRequestSource is the source of the history entries of force requests
+	ForceRequestSource = "force-request"
+)
+
+// HistoryEntry is the outcome of processing an event for a UUID.
+type HistoryEntry struct {
+	UUID         string    `json:"uuid"`
+	Topic        string    `json:"topic"`
+	Origin       string    `json:"origin,omitempty"`
+	Caller       string    `json:"caller,omitempty"`
+	TID          string    `json:"tid"`
+	Decision     string    `json:"decision"`
+	Reason       string    `json:"reason,omitempty"`
+	OutputTopic  string    `json:"outputTopic,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	ReceivedAt   time.Time `json:"receivedAt"`
+	DecidedAt    time.Time `json:"decidedAt"`
+}
+
+func newHistoryEntry(topic string, headers map[string]string, tid string) *HistoryEntry {
+	return &HistoryEntry{Topic: topic, Origin: headers["Origin-System-Id"], TID: tid, ReceivedAt: time.Now()}
+}
+
+func (e *HistoryEntry) skip(reason string) {
+	e.Decision = DecisionSkipped
+	e.Reason = reason
+}
+
+// skipReason describes the errors of the messages the forwarder deliberately didn't forward.
+func skipReason(err error, model *CombinedModel) string {
+	switch err {
+	case InvalidContentTypeError:
+		contentType, _ := model.contentType()
+		return "unsupported content type " + contentType
+	case StaleContentError:
+		return "older than the content already forwarded"
+	case UnchangedContentError:
+		return "unchanged since the last message forwarded"
+	}
+	return err.Error()
+}
+
+// History keeps the most recent processing outcomes in a ring buffer, to tell what happened to a UUID.
+// When it has a path, the outcomes are saved there every DefaultHistorySaveInterval and on Stop, and loaded on start.
+type History struct {
+	sync.Mutex
+	entries []HistoryEntry
+	next    int
+	path    string
+	stop    chan struct{}
+}
+
+// NewHistory keeps no entries when the capacity isn't positive.
+func NewHistory(capacity int, path string) (*History, error) {
+	if capacity < 0 {
+		capacity = 0
+	}
+	h := &History{entries: make([]HistoryEntry, 0, capacity), path: path, stop: make(chan struct{})}
+	if path == "" {
+		return h, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []HistoryEntry
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, err
+	}
+	for _, e := range saved {
+		h.add(e)
+	}
+	return h, nil
+}
+
+// Record completes the entry with the outcome of the processing, which is forwarded unless decided otherwise or failed.
+// Entries without a UUID are not recorded, as there is nothing to look them up by.
+func (h *History) Record(e *HistoryEntry, err error) {
+	if h == nil || e.UUID == "" {
+		return
+	}
+	if err != nil {
+		e.Decision = DecisionFailed
+		e.Reason = err.Error()
+	}
+	if e.Decision == "" {
+		e.Decision = DecisionForwarded
+	}
+	if e.Decision != DecisionForwarded {
+		e.OutputTopic = ""
+	}
+	e.DecidedAt = time.Now()
+
+	h.Lock()
+	defer h.Unlock()
+	h.add(*e)
+}
+
+func (h *History) add(e HistoryEntry) {
+	if len(h.entries) < cap(h.entries) {
+		h.entries = append(h.entries, e)
+		return
+	}
+	if len(h.entries) == 0 {
+		return
+	}
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// ForUUID returns the entries of the UUID, the oldest first.
+func (h *History) ForUUID(uuid string) []HistoryEntry {
+	found := []HistoryEntry{}
+	h.Lock()
+	defer h.Unlock()
+	for _, e := range h.ordered() {
+		if strings.EqualFold(e.UUID, uuid) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func (h *History) ordered() []HistoryEntry {
+	return append(append([]HistoryEntry{}, h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+// Start saves the history periodically, until Stop is called.
+func (h *History) Start() {
+	if h.path == "" {
+		return
+	}
+	ticker := time.NewTicker(DefaultHistorySaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			if err := h.Save(); err != nil {
+				logger.WithError(err).Error("Could not save the processing history")
+			}
+		}
+	}
+}
+
+func (h *History) Stop() {
+	close(h.stop)
+	if err := h.Save(); err != nil {
+		logger.WithError(err).Error("Could not save the processing history")
+	}
+}
+
+func (h *History) Save() error {
+	if h.path == "" {
+		return nil
+	}
+	h.Lock()
+	b, err := json.Marshal(h.ordered())
+	h.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(h.path, b)
+}
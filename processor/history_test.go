@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory_KeepsTheMostRecentEntries(t *testing.T) {
+	h, err := NewHistory(3, "")
+	assert.NoError(t, err)
+
+	for _, tid := range []string{"tid1", "tid2", "tid3", "tid4"} {
+		h.Record(&HistoryEntry{UUID: "some_uuid", TID: tid}, nil)
+	}
+	h.Record(&HistoryEntry{TID: "no-uuid"}, nil)
+
+	entries := h.ForUUID("SOME_UUID")
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "tid2", entries[0].TID)
+	assert.Equal(t, "tid4", entries[2].TID)
+	assert.Equal(t, DecisionForwarded, entries[2].Decision)
+	assert.False(t, entries[2].DecidedAt.IsZero())
+	assert.Empty(t, h.ForUUID("other_uuid"))
+}
+
+func TestHistory_WithoutCapacityKeepsNoEntries(t *testing.T) {
+	for _, capacity := range []int{0, -1} {
+		h, err := NewHistory(capacity, "")
+		assert.NoError(t, err)
+		h.Record(&HistoryEntry{UUID: "some_uuid", TID: "tid1"}, nil)
+		assert.Empty(t, h.ForUUID("some_uuid"))
+	}
+}
+
+func TestHistory_RecordsDecisions(t *testing.T) {
+	h, err := NewHistory(10, "")
+	assert.NoError(t, err)
+
+	skipped := &HistoryEntry{UUID: "some_uuid", OutputTopic: "CombinedPostPublicationEvents"}
+	skipped.skip("some reason")
+	h.Record(skipped, nil)
+	h.Record(&HistoryEntry{UUID: "some_uuid", OutputTopic: "CombinedPostPublicationEvents"}, errors.New("some error"))
+
+	entries := h.ForUUID("some_uuid")
+	assert.Equal(t, DecisionSkipped, entries[0].Decision)
+	assert.Equal(t, "some reason", entries[0].Reason)
+	assert.Empty(t, entries[0].OutputTopic)
+	assert.Equal(t, DecisionFailed, entries[1].Decision)
+	assert.Equal(t, "some error", entries[1].Reason)
+}
+
+func TestHistory_IsSavedAndLoaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history", "history.json")
+
+	h, err := NewHistory(10, path)
+	assert.NoError(t, err)
+	h.Record(&HistoryEntry{UUID: "some_uuid", TID: "tid1"}, nil)
+	go h.Start()
+	h.Stop()
+
+	loaded, err := NewHistory(10, path)
+	assert.NoError(t, err)
+	entries := loaded.ForUUID("some_uuid")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "tid1", entries[0].TID)
+}
+
+func TestProcessContentMsg_RecordsHistory(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "some-origin"}, "./testData/content.json")
+	assert.NoError(t, err)
+	history, err := NewHistory(10, "")
+	assert.NoError(t, err)
+
+	config := MsgProcessorConfig{SupportedContentURIs: []string{"unknown-mapper"}, ContentTopic: "PostPublicationEvents"}
+	p := &MsgProcessor{config: config, History: history}
+	assert.NoError(t, p.processContentMsg(m))
+
+	entries := history.ForUUID("0cef259d-030d-497d-b4ef-e8fa0ee6db6b")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "PostPublicationEvents", entries[0].Topic)
+	assert.Equal(t, "some-origin", entries[0].Origin)
+	assert.Equal(t, "some-tid1", entries[0].TID)
+	assert.Equal(t, DecisionSkipped, entries[0].Decision)
+	assert.Contains(t, entries[0].Reason, "unsupported contentUri")
+}
+
+func TestProcessMetadataMsg_RecordsHistory(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "http://cmdb.ft.com/systems/binding-service"}, "./testData/annotations.json")
+	assert.NoError(t, err)
+	history, err := NewHistory(10, "")
+	assert.NoError(t, err)
+
+	config := MsgProcessorConfig{SupportedHeaders: []string{"http://cmdb.ft.com/systems/binding-service"}, MetadataTopic: "PostConceptAnnotations"}
+	f := NewForwarder(&RecordingMsgProducer{}, []string{"Video"})
+	f.Topic = "CombinedPostPublicationEvents"
+	var ann AnnotationsMessage
+	assert.NoError(t, json.Unmarshal([]byte(m.Body), &ann))
+	combiner := DummyDataCombiner{t: t, expectedMetadata: ann, data: CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}}
+	p := &MsgProcessor{config: config, DataCombiner: combiner, Forwarder: f, History: history}
+	assert.NoError(t, p.processMetadataMsg(m))
+
+	entries := history.ForUUID(ann.getContentUUID())
+	assert.Len(t, entries, 1)
+	assert.Equal(t, DecisionSkipped, entries[0].Decision)
+	assert.Equal(t, "unsupported content type Article", entries[0].Reason)
+	assert.Empty(t, entries[0].OutputTopic)
+
+	p.Forwarder.SupportedContentTypes = []string{"Article"}
+	assert.NoError(t, p.processMetadataMsg(consumer.Message{Headers: m.Headers, Body: m.Body}))
+	entries = history.ForUUID(ann.getContentUUID())
+	assert.Len(t, entries, 2)
+	assert.Equal(t, DecisionForwarded, entries[1].Decision)
+	assert.Equal(t, "CombinedPostPublicationEvents", entries[1].OutputTopic)
+	assert.Equal(t, "2017-03-30T13:09:06.48Z", entries[1].LastModified)
+}
+
+func TestForceMessagePublish_RecordsHistory(t *testing.T) {
+	history, err := NewHistory(10, "")
+	assert.NoError(t, err)
+	combiner := DummyDataCombiner{t: t, expectedUUID: "some_uuid", data: CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Video"}}}
+	p := &RequestProcessor{DataCombiner: combiner, Forwarder: NewForwarder(&RecordingMsgProducer{}, []string{"Article"}), History: history}
+
+	assert.Equal(t, InvalidContentTypeError, p.ForceMessagePublish("some_uuid", "some-tid1", ""))
+
+	entries := history.ForUUID("some_uuid")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, ForceRequestSource, entries[0].Topic)
+	assert.Equal(t, CombinerOrigin, entries[0].Origin)
+	assert.Equal(t, DecisionSkipped, entries[0].Decision)
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	FeedDroppedMetric = "combiner.feed.dropped"
+
+	feedBufferSize = 100
+)
+
+// FeedEvent describes a forwarded combined message. Message is only set for the subscriptions to the full messages.
+type FeedEvent struct {
+	UUID          string          `json:"uuid"`
+	Type          string          `json:"type,omitempty"`
+	MarkedDeleted string          `json:"markedDeleted"`
+	TID           string          `json:"tid"`
+	Origin        string          `json:"origin,omitempty"`
+	Topic         string          `json:"topic"`
+	Message       json.RawMessage `json:"message,omitempty"`
+}
+
+// FeedFilter selects the events of a subscription, all of them are selected when a filter is empty.
+type FeedFilter struct {
+	Types   []string
+	UUIDs   []string
+	Origins []string
+}
+
+func (f FeedFilter) matches(e FeedEvent) bool {
+	return (len(f.Types) == 0 || contains(f.Types, e.Type)) &&
+		(len(f.UUIDs) == 0 || contains(f.UUIDs, e.UUID)) &&
+		(len(f.Origins) == 0 || contains(f.Origins, e.Origin))
+}
+
+// FeedSubscription receives the events matching its filter on Events.
+type FeedSubscription struct {
+	Events  chan FeedEvent
+	filter  FeedFilter
+	full    bool
+	dropped int64
+}
+
+// LiveFeed streams the forwarded combined messages to its subscribers.
+// Publishing never waits for the subscribers: events are dropped for the ones not keeping up, and counted in the combiner.feed.dropped metric.
+type LiveFeed struct {
+	sync.Mutex
+	subscriptions map[*FeedSubscription]struct{}
+}
+
+func NewLiveFeed() *LiveFeed {
+	return &LiveFeed{subscriptions: map[*FeedSubscription]struct{}{}}
+}
+
+// Subscribe starts a subscription to the events matching filter, with the full combined messages when full is set.
+func (f *LiveFeed) Subscribe(filter FeedFilter, full bool) *FeedSubscription {
+	s := &FeedSubscription{Events: make(chan FeedEvent, feedBufferSize), filter: filter, full: full}
+	f.Lock()
+	f.subscriptions[s] = struct{}{}
+	f.Unlock()
+	return s
+}
+
+func (f *LiveFeed) Unsubscribe(s *FeedSubscription) {
+	f.Lock()
+	delete(f.subscriptions, s)
+	f.Unlock()
+}
+
+func (f *LiveFeed) Publish(topic string, headers map[string]string, model *CombinedModel) {
+	e := FeedEvent{
+		UUID:          model.UUID,
+		MarkedDeleted: model.MarkedDeleted,
+		TID:           headers["X-Request-Id"],
+		Origin:        headers["Origin-System-Id"],
+		Topic:         topic,
+	}
+	e.Type, _ = model.contentType()
+
+	f.Lock()
+	defer f.Unlock()
+	var message json.RawMessage
+	for s := range f.subscriptions {
+		if !s.filter.matches(e) {
+			continue
+		}
+		event := e
+		if s.full {
+			if message == nil {
+				b, err := json.Marshal(model)
+				if err != nil {
+					logger.WithTransactionID(e.TID).WithUUID(e.UUID).WithError(err).Errorf("%v - Could not marshal the combined message for the live feed", e.TID)
+					return
+				}
+				message = b
+			}
+			event.Message = message
+		}
+		select {
+		case s.Events <- event:
+		default:
+			s.dropped++
+			metrics.GetOrRegisterCounter(FeedDroppedMetric, metrics.DefaultRegistry).Inc(1)
+		}
+	}
+}
+
+// Dropped is the number of events not sent to the subscription, as it wasn't keeping up.
+func (f *LiveFeed) Dropped(s *FeedSubscription) int64 {
+	f.Lock()
+	defer f.Unlock()
+	return s.dropped
+}
@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveFeed_PublishesMatchingEvents(t *testing.T) {
+	feed := NewLiveFeed()
+	all := feed.Subscribe(FeedFilter{}, false)
+	videos := feed.Subscribe(FeedFilter{Types: []string{"Video"}}, false)
+	full := feed.Subscribe(FeedFilter{UUIDs: []string{"some_uuid"}, Origins: []string{"some-origin"}}, true)
+
+	model := &CombinedModel{UUID: "some_uuid", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	feed.Publish("CombinedPostPublicationEvents", map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "some-origin"}, model)
+
+	assert.Len(t, all.Events, 1)
+	assert.Len(t, videos.Events, 0)
+	assert.Len(t, full.Events, 1)
+
+	e := <-all.Events
+	assert.Equal(t, FeedEvent{UUID: "some_uuid", Type: "Article", MarkedDeleted: "false", TID: "some-tid1", Origin: "some-origin", Topic: "CombinedPostPublicationEvents"}, e)
+
+	e = <-full.Events
+	var message CombinedModel
+	assert.NoError(t, json.Unmarshal(e.Message, &message))
+	assert.Equal(t, "some_uuid", message.UUID)
+}
+
+func TestLiveFeed_DropsEventsForSlowSubscribers(t *testing.T) {
+	feed := NewLiveFeed()
+	slow := feed.Subscribe(FeedFilter{}, false)
+
+	for i := 0; i < feedBufferSize+3; i++ {
+		feed.Publish("CombinedPostPublicationEvents", map[string]string{}, &CombinedModel{UUID: "some_uuid"})
+	}
+
+	assert.Len(t, slow.Events, feedBufferSize)
+	assert.Equal(t, int64(3), feed.Dropped(slow))
+
+	feed.Unsubscribe(slow)
+	<-slow.Events
+	feed.Publish("CombinedPostPublicationEvents", map[string]string{}, &CombinedModel{UUID: "some_uuid"})
+	assert.Len(t, slow.Events, feedBufferSize-1)
+}
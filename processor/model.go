@@ -9,13 +9,22 @@ type ContentMessage struct {
 type ContentModel map[string]interface{}
 
 type CombinedModel struct {
+	SchemaVersion string `json:"schemaVersion"`
+
 	UUID     string       `json:"uuid"`
 	Content  ContentModel `json:"content"`
 	Metadata []Annotation `json:"metadata"`
+	// MetadataStatus tells why the metadata is empty, it's not set for deletes
+	MetadataStatus string `json:"metadataStatus,omitempty"`
 
 	ContentURI    string `json:"contentUri"`
 	LastModified  string `json:"lastModified"`
 	MarkedDeleted string `json:"markedDeleted"`
+	// LastKnownType and LastKnownIdentifiers are those of the deleted content, when known, and only set for deletes
+	LastKnownType        string      `json:"lastKnownType,omitempty"`
+	LastKnownIdentifiers interface{} `json:"lastKnownIdentifiers,omitempty"`
+	// Stale marks content older than the last one forwarded for the same uuid
+	Stale bool `json:"stale,omitempty"`
 }
 
 type AnnotationsMessage struct {
@@ -43,6 +52,17 @@ type Thing struct {
 
 //******************* GET EXPECTED VALUES *********************
 
+// contentType is the type of the content, or the last known type of the deleted content. It's not known when there is neither.
+func (cm *CombinedModel) contentType() (string, bool) {
+	if cm.Content != nil {
+		return cm.Content.getType(), true
+	}
+	if cm.LastKnownType != "" {
+		return cm.LastKnownType, true
+	}
+	return "", false
+}
+
 func (cm ContentModel) getUUID() string {
 	return getMapValueAsString("uuid", cm)
 }
@@ -1,32 +1,196 @@
 package processor
 
 import (
-	"github.com/Financial-Times/message-queue-gonsumer/consumer"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+)
+
+const (
+	DefaultMaxDeliveryAttempts = 3
+	DefaultRedeliveryBackoff   = 5 * time.Second
 )
 
 type QConsumer interface {
 	ProcessMsg(m consumer.Message)
 }
 
+// DeliveryPolicy controls how many times a failed message is handed back to the processor before it is dead-lettered.
+type DeliveryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+func NewDeliveryPolicy(maxAttempts int, backoff time.Duration) DeliveryPolicy {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxDeliveryAttempts
+	}
+	return DeliveryPolicy{MaxAttempts: maxAttempts, Backoff: backoff}
+}
+
 type KafkaQConsumer struct {
-	Consumer consumer.MessageConsumer
-	dest     chan<- *KafkaQMessage
-	msgType  string
+	Consumer   consumer.MessageConsumer
+	dest       chan<- *KafkaQMessage
+	msgType    string
+	policy     DeliveryPolicy
+	deadLetter DeadLetterQueue
+	// Retries takes over the messages failing with a transient error, instead of redelivering them in place
+	Retries *RetryQueue
+	state   consumerState
+}
+
+// consumerState tracks whether the consumer is paused, and the end of the current consumption, which must be over before consuming again.
+type consumerState struct {
+	sync.Mutex
+	paused  bool
+	stopped bool
+	done    chan struct{}
+	// stopping is set once the current consumption was asked to stop, the gonsumer only takes a single stop request
+	stopping bool
+}
+
+func (s *consumerState) stopConsuming(c consumer.MessageConsumer) {
+	if s.done != nil && !s.stopping {
+		s.stopping = true
+		c.Stop()
+	}
 }
 
 type KafkaQMessage struct {
 	msgType string
 	msg     consumer.Message
+	done    chan error
+}
+
+func newKafkaQMessage(msgType string, m consumer.Message) *KafkaQMessage {
+	return &KafkaQMessage{msgType: msgType, msg: m, done: make(chan error, 1)}
+}
+
+// ack reports the processing outcome back to the consumer waiting for it.
+func (m *KafkaQMessage) ack(err error) {
+	if m.done != nil {
+		m.done <- err
+	}
 }
 
-func NewKafkaQConsumer(cConf consumer.QueueConfig, ch chan<- *KafkaQMessage, client *http.Client) *KafkaQConsumer {
+func NewKafkaQConsumer(cConf consumer.QueueConfig, ch chan<- *KafkaQMessage, client *http.Client, policy DeliveryPolicy, deadLetter DeadLetterQueue) *KafkaQConsumer {
 
-	kc := KafkaQConsumer{msgType: cConf.Topic, dest: ch}
+	kc := KafkaQConsumer{msgType: cConf.Topic, dest: ch, policy: policy, deadLetter: deadLetter}
+	// offsets must only be committed by the gonsumer once every message of the batch has been handled
+	cConf.AutoCommitEnable = false
 	kc.Consumer = consumer.NewConsumer(cConf, kc.ProcessMsg, client)
 	return &kc
 }
 
+// Start consumes messages until the consumer is stopped or paused. Like the gonsumer's Start, it blocks.
+func (c *KafkaQConsumer) Start() {
+	c.state.Lock()
+	if c.state.paused || c.state.stopped || c.state.done != nil {
+		c.state.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	c.state.done = done
+	c.state.stopping = false
+	c.state.Unlock()
+
+	c.Consumer.Start()
+
+	c.state.Lock()
+	c.state.done = nil
+	c.state.Unlock()
+	close(done)
+}
+
+// Pause stops pulling messages from kafka-proxy, once the messages already pulled were processed.
+func (c *KafkaQConsumer) Pause() {
+	c.state.Lock()
+	defer c.state.Unlock()
+	if c.state.paused || c.state.stopped {
+		return
+	}
+	c.state.paused = true
+	c.state.stopConsuming(c.Consumer)
+	logger.Infof("Consumer of %v paused", c.msgType)
+}
+
+// Resume consumes messages again, after the consumption stopped by Pause is over.
+func (c *KafkaQConsumer) Resume() {
+	c.state.Lock()
+	defer c.state.Unlock()
+	if !c.state.paused || c.state.stopped {
+		return
+	}
+	c.state.paused = false
+	done := c.state.done
+	go func() {
+		if done != nil {
+			<-done
+		}
+		c.Start()
+	}()
+	logger.Infof("Consumer of %v resumed", c.msgType)
+}
+
+func (c *KafkaQConsumer) Paused() bool {
+	c.state.Lock()
+	defer c.state.Unlock()
+	return c.state.paused
+}
+
+// Stop stops consuming for good.
+func (c *KafkaQConsumer) Stop() {
+	c.state.Lock()
+	defer c.state.Unlock()
+	if c.state.stopped {
+		return
+	}
+	c.state.stopped = true
+	c.state.stopConsuming(c.Consumer)
+}
+
+func (c *KafkaQConsumer) Topic() string {
+	return c.msgType
+}
+
+// ProcessMsg hands the message to the processor and blocks until it was forwarded or dead-lettered.
+// The gonsumer commits the offsets of a batch only after the handler returned for all of its messages,
+// so a crash while a message is in flight results in the message being redelivered, not lost.
 func (c *KafkaQConsumer) ProcessMsg(m consumer.Message) {
-	c.dest <- &KafkaQMessage{msgType: c.msgType, msg: m}
+	var err error
+	for attempt := 1; ; attempt++ {
+		km := newKafkaQMessage(c.msgType, m)
+		c.dest <- km
+		if err = <-km.done; err == nil {
+			return
+		}
+		if IsPermanentError(err) {
+			break
+		}
+		if c.Retries != nil {
+			retryErr := c.Retries.Schedule(c.msgType, m, 0, err)
+			if retryErr == nil {
+				return
+			}
+			logger.WithTransactionID(m.Headers["X-Request-Id"]).WithError(retryErr).Errorf("Could not schedule the retry of message from %v, it will be redelivered.", c.msgType)
+		}
+		if attempt >= c.policy.MaxAttempts {
+			break
+		}
+		logger.WithTransactionID(m.Headers["X-Request-Id"]).WithError(err).Warnf("Processing attempt %d of %d failed for message from %v, it will be redelivered.", attempt, c.policy.MaxAttempts, c.msgType)
+		time.Sleep(c.policy.Backoff)
+	}
+
+	// the offset can't be committed until the message is safely parked on the dead-letter path
+	for {
+		dlErr := c.deadLetter.Send(c.msgType, m, err)
+		if dlErr == nil {
+			return
+		}
+		logger.WithTransactionID(m.Headers["X-Request-Id"]).WithError(dlErr).Errorf("Could not dead-letter message from %v, retrying.", c.msgType)
+		time.Sleep(c.policy.Backoff)
+	}
 }
@@ -1,9 +1,12 @@
 package processor
 
 import (
+	"errors"
+	"testing"
+	"time"
+
 	"github.com/Financial-Times/message-queue-gonsumer/consumer"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 type DummyConsumer struct{}
@@ -27,6 +30,7 @@ func TestQConsumerProcessMsg(t *testing.T) {
 		Consumer: DummyConsumer{},
 		dest:     ch,
 		msgType:  mType,
+		policy:   NewDeliveryPolicy(1, 0),
 	}
 
 	msgs := []consumer.Message{
@@ -40,18 +44,191 @@ func TestQConsumerProcessMsg(t *testing.T) {
 		},
 	}
 
+	received := make(chan *KafkaQMessage, len(msgs))
+	go func() {
+		for el := range ch {
+			received <- el
+			el.ack(nil)
+		}
+		close(received)
+	}()
+
 	for _, m := range msgs {
 		kqc.ProcessMsg(m)
 	}
 	close(ch)
 
-	assert.Equal(t, 5, cap(ch))
-	assert.Equal(t, len(msgs), len(ch))
-
 	i := 0
-	for el := range ch {
+	for el := range received {
 		assert.Equal(t, msgs[i], el.msg)
 		assert.Equal(t, mType, el.msgType)
 		i++
 	}
+	assert.Equal(t, len(msgs), i)
+}
+
+func TestQConsumerProcessMsg_BlocksUntilAcknowledged(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	kqc := KafkaQConsumer{Consumer: DummyConsumer{}, dest: ch, msgType: "someType", policy: NewDeliveryPolicy(1, 0)}
+
+	returned := make(chan struct{})
+	go func() {
+		kqc.ProcessMsg(consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"})
+		close(returned)
+	}()
+
+	km := <-ch
+	select {
+	case <-returned:
+		t.Fatal("ProcessMsg returned before the message was acknowledged")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	km.ack(nil)
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("ProcessMsg didn't return after the message was acknowledged")
+	}
+}
+
+func TestQConsumerProcessMsg_RedeliversFailedMessage(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	kqc := KafkaQConsumer{Consumer: DummyConsumer{}, dest: ch, msgType: "someType", policy: NewDeliveryPolicy(3, 0), deadLetter: NewDeadLetterQueue(dlq)}
+
+	attempts := 0
+	go func() {
+		for km := range ch {
+			attempts++
+			if attempts < 2 {
+				km.ack(errors.New("some error"))
+				continue
+			}
+			km.ack(nil)
+		}
+	}()
+
+	kqc.ProcessMsg(consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"})
+	close(ch)
+
+	assert.Equal(t, 2, attempts)
+	assert.Empty(t, dlq.msgs)
+}
+
+func TestQConsumerProcessMsg_DeadLettersAfterMaxAttempts(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	kqc := KafkaQConsumer{Consumer: DummyConsumer{}, dest: ch, msgType: "someType", policy: NewDeliveryPolicy(3, 0), deadLetter: NewDeadLetterQueue(dlq)}
+
+	attempts := 0
+	go func() {
+		for km := range ch {
+			attempts++
+			km.ack(errors.New("some error"))
+		}
+	}()
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	kqc.ProcessMsg(m)
+	close(ch)
+
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, dlq.msgs, 1)
+	assert.Equal(t, m.Body, dlq.msgs[0].Body)
+	assert.Equal(t, "someType", dlq.msgs[0].Headers[DeadLetterSourceTopicHeader])
+	assert.Equal(t, "some error", dlq.msgs[0].Headers[DeadLetterReasonHeader])
+}
+
+func TestQConsumerProcessMsg_DeadLettersPermanentErrorsImmediately(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	kqc := KafkaQConsumer{Consumer: DummyConsumer{}, dest: ch, msgType: "someType", policy: NewDeliveryPolicy(3, 0), deadLetter: NewDeadLetterQueue(dlq)}
+
+	attempts := 0
+	go func() {
+		for km := range ch {
+			attempts++
+			km.ack(newPermanentError(errors.New("invalid body")))
+		}
+	}()
+
+	kqc.ProcessMsg(consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"})
+	close(ch)
+
+	assert.Equal(t, 1, attempts)
+	assert.Len(t, dlq.msgs, 1)
+}
+
+// blockingConsumer consumes until it's stopped, as the gonsumer does.
+type blockingConsumer struct {
+	starts chan struct{}
+	stop   chan struct{}
+}
+
+func newBlockingConsumer() *blockingConsumer {
+	return &blockingConsumer{starts: make(chan struct{}, 10), stop: make(chan struct{}, 1)}
+}
+
+func (c *blockingConsumer) Start() {
+	c.starts <- struct{}{}
+	<-c.stop
+}
+
+func (c *blockingConsumer) Stop() {
+	c.stop <- struct{}{}
+}
+
+func (c *blockingConsumer) ConnectivityCheck() (string, error) {
+	return "", nil
+}
+
+func TestQConsumer_PauseAndResume(t *testing.T) {
+	bc := newBlockingConsumer()
+	kqc := &KafkaQConsumer{Consumer: bc, msgType: "someType"}
+
+	go kqc.Start()
+	waitForStart(t, bc)
+	assert.False(t, kqc.Paused())
+
+	kqc.Pause()
+	kqc.Pause()
+	assert.True(t, kqc.Paused())
+	kqc.Resume()
+	assert.False(t, kqc.Paused())
+	waitForStart(t, bc)
+
+	kqc.Stop()
+	kqc.Resume()
+	kqc.Stop()
+	select {
+	case <-bc.starts:
+		t.Fatal("the consumer started again after it was stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestQConsumer_StartsPausedConsumersOnResume(t *testing.T) {
+	bc := newBlockingConsumer()
+	kqc := &KafkaQConsumer{Consumer: bc, msgType: "someType"}
+
+	kqc.Pause()
+	go kqc.Start()
+	select {
+	case <-bc.starts:
+		t.Fatal("a paused consumer started")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	kqc.Resume()
+	waitForStart(t, bc)
+	kqc.Stop()
+}
+
+func waitForStart(t *testing.T, bc *blockingConsumer) {
+	select {
+	case <-bc.starts:
+	case <-time.After(time.Second):
+		t.Fatal("the consumer didn't start")
+	}
 }
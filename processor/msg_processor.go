@@ -3,10 +3,10 @@ package processor
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/Financial-Times/go-logger"
-	"github.com/Financial-Times/message-queue-go-producer/producer"
 	"github.com/Financial-Times/message-queue-gonsumer/consumer"
 	"github.com/dchest/uniuri"
 
@@ -16,6 +16,7 @@ import (
 var (
 	NotFoundError           = errors.New("content not found") // used when the content can not be found by the platform
 	InvalidContentTypeError = errors.New("invalid content type")
+	StaleContentError       = errors.New("stale content") // used when newer content was already forwarded for the same uuid
 )
 
 type MsgProcessor struct {
@@ -23,6 +24,14 @@ type MsgProcessor struct {
 	config       MsgProcessorConfig
 	DataCombiner DataCombinerI
 	Forwarder    Forwarder
+	// State remembers the type of the content, to route delete events. It's shared with the RequestProcessor.
+	State StateStore
+	// Recombiner combines again the content forwarded without annotations
+	Recombiner *Recombiner
+	// History records the outcome of every message. It's shared with the RequestProcessor.
+	History *History
+	// Whitelists replaces the whitelists of the config when set, so that they can change at runtime
+	Whitelists *Whitelists
 }
 
 type MsgProcessorConfig struct {
@@ -30,6 +39,9 @@ type MsgProcessorConfig struct {
 	SupportedHeaders     []string
 	ContentTopic         string
 	MetadataTopic        string
+	StalePolicy          StalePolicy
+	// FailurePolicies has the action per topic when the annotations can't be read, retry by default
+	FailurePolicies map[string]string
 }
 
 func NewMsgProcessorConfig(supportedURIs []string, supportedHeaders []string, contentTopic string, metadataTopic string) MsgProcessorConfig {
@@ -41,38 +53,50 @@ func NewMsgProcessorConfig(supportedURIs []string, supportedHeaders []string, co
 	}
 }
 
-func NewMsgProcessor(srcCh <-chan *KafkaQMessage, config MsgProcessorConfig, dataCombiner DataCombinerI, producer producer.MessageProducer, whitelistedContentTypes []string) *MsgProcessor {
-	return &MsgProcessor{src: srcCh, config: config, DataCombiner: dataCombiner, Forwarder: NewForwarder(producer, whitelistedContentTypes)}
+func NewMsgProcessor(srcCh <-chan *KafkaQMessage, config MsgProcessorConfig, dataCombiner DataCombinerI, sink Sink, whitelistedContentTypes []string) *MsgProcessor {
+	return &MsgProcessor{src: srcCh, config: config, DataCombiner: dataCombiner, Forwarder: NewForwarder(sink, whitelistedContentTypes)}
 }
 
 func (p *MsgProcessor) ProcessMessages() {
 	for {
 		m := <-p.src
+		var err error
 		if m.msgType == p.config.ContentTopic {
-			p.processContentMsg(m.msg)
+			err = p.processContentMsg(m.msg)
 		} else if m.msgType == p.config.MetadataTopic {
-			p.processMetadataMsg(m.msg)
+			err = p.processMetadataMsg(m.msg)
 		}
+		m.ack(err)
 	}
 }
 
-func (p *MsgProcessor) processContentMsg(m consumer.Message) {
+// processContentMsg returns nil once the message was forwarded or deliberately skipped.
+// Errors that redelivery can't fix are marked as permanent, so that the message goes straight to the dead-letter path.
+func (p *MsgProcessor) processContentMsg(m consumer.Message) (err error) {
 
 	tid := extractTID(m.Headers)
 	m.Headers["X-Request-Id"] = tid
+	entry := newHistoryEntry(p.config.ContentTopic, m.Headers, tid)
+	defer func() { p.History.Record(entry, err) }()
 
 	//parse message - collect data, then forward it to the next queue
 	var cm ContentMessage
 	b := []byte(m.Body)
 	if err := json.Unmarshal(b, &cm); err != nil {
 		logger.WithTransactionID(tid).WithError(err).Errorf("Could not unmarshall message with TID=%v", tid)
-		return
+		return newPermanentError(err)
+	}
+	entry.UUID = cm.ContentModel.getUUID()
+	if entry.UUID == "" {
+		entry.UUID = cm.ContentURI[strings.LastIndex(cm.ContentURI, "/")+1:]
 	}
+	entry.LastModified = cm.LastModified
 
 	// wordpress, next-video, methode-article - the system origin is not enough to help us filtering. Filter by contentUri.
-	if !containsSubstringOf(p.config.SupportedContentURIs, cm.ContentURI) {
+	if !containsSubstringOf(p.whitelist().ContentURIs, cm.ContentURI) {
 		logger.WithTransactionID(tid).Infof("%v - Skipped unsupported content with contentUri: %v. ", tid, cm.ContentURI)
-		return
+		entry.skip("unsupported contentUri " + cm.ContentURI)
+		return nil
 	}
 
 	var combinedMSG CombinedModel
@@ -84,62 +108,110 @@ func (p *MsgProcessor) processContentMsg(m consumer.Message) {
 		uuid := sl[len(sl)-1]
 		if _, err := uuidlib.FromString(uuid); err != nil || uuid == "" {
 			logger.WithTransactionID(tid).WithError(err).Errorf("UUID couldn't be determined, skipping message with TID=%v.", tid)
-			return
+			return newPermanentError(fmt.Errorf("UUID couldn't be determined from contentUri=%v", cm.ContentURI))
 		}
 		combinedMSG.UUID = uuid
 		combinedMSG.ContentURI = cm.ContentURI
 		combinedMSG.LastModified = cm.LastModified
 		combinedMSG.MarkedDeleted = "true"
+		enrichDelete(p.State, &combinedMSG, tid)
 	} else {
 
 		//combine data
 		if cm.ContentModel.getUUID() == "" {
 			logger.WithTransactionID(tid).Errorf("UUID not found after message marshalling, skipping message with contentUri=%v.", cm.ContentURI)
-			return
+			return newPermanentError(fmt.Errorf("UUID not found for contentUri=%v", cm.ContentURI))
 		}
 
 		var err error
 		combinedMSG, err = p.DataCombiner.GetCombinedModelForContent(cm.ContentModel)
 		if err != nil {
-			logger.WithTransactionID(tid).WithUUID(cm.ContentModel.getUUID()).WithError(err).Errorf("%v - Error obtaining the combined message. Metadata could not be read. Message will be skipped.", tid)
-			return
+			partial, err := p.onCombineFailure(p.config.ContentTopic, m.Headers, cm.ContentURI, err, tid)
+			if partial == nil {
+				if err != nil {
+					logger.WithTransactionID(tid).WithUUID(cm.ContentModel.getUUID()).WithError(err).Errorf("%v - Error obtaining the combined message. Metadata could not be read. Message will be skipped.", tid)
+				}
+				entry.skip("annotations could not be read")
+				return err
+			}
+			combinedMSG = *partial
 		}
 
 		combinedMSG.ContentURI = cm.ContentURI
 		combinedMSG.MarkedDeleted = "false"
+		rememberContent(p.State, &combinedMSG, tid)
 	}
 
 	//forward data
-	p.Forwarder.filterAndForwardMsg(m.Headers, &combinedMSG, tid)
+	return p.forward(m.Headers, &combinedMSG, entry, tid)
 }
 
-func (p *MsgProcessor) processMetadataMsg(m consumer.Message) {
+func (p *MsgProcessor) processMetadataMsg(m consumer.Message) (err error) {
 
 	tid := extractTID(m.Headers)
 	m.Headers["X-Request-Id"] = tid
 	h := m.Headers["Origin-System-Id"]
+	entry := newHistoryEntry(p.config.MetadataTopic, m.Headers, tid)
+	defer func() { p.History.Record(entry, err) }()
+
+	//parse message - collect data, then forward it to the next queue
+	var ann AnnotationsMessage
+	b := []byte(m.Body)
+	parseErr := json.Unmarshal(b, &ann)
+	entry.UUID = ann.getContentUUID()
+	entry.LastModified = ann.LastModified
 
 	//decide based on the origin system header - whether you want to process the message or not
-	if !containsSubstringOf(p.config.SupportedHeaders, h) {
+	if !containsSubstringOf(p.whitelist().Origins, h) {
 		logger.WithTransactionID(tid).Infof("%v - Skipped unsupported annotations with Origin-System-Id: %v. ", tid, h)
-		return
+		entry.skip("unsupported Origin-System-Id " + h)
+		return nil
 	}
 
-	//parse message - collect data, then forward it to the next queue
-	var ann AnnotationsMessage
-	b := []byte(m.Body)
-	if err := json.Unmarshal(b, &ann); err != nil {
-		logger.WithTransactionID(tid).WithError(err).Errorf("Could not unmarshall message with TID=%v", tid)
-		return
+	if parseErr != nil {
+		logger.WithTransactionID(tid).WithError(parseErr).Errorf("Could not unmarshall message with TID=%v", tid)
+		return newPermanentError(parseErr)
 	}
 
-	//combine data
-	combinedMSG, err := p.DataCombiner.GetCombinedModelForAnnotations(ann)
+	//combine data - the content read might be older than the one already forwarded
+	combinedMSG, err := combineWithStalePolicy(func() (CombinedModel, error) {
+		return p.DataCombiner.GetCombinedModelForAnnotations(ann)
+	}, p.Forwarder.Watermarks, p.config.StalePolicy, tid)
 	if err != nil {
-		logger.WithTransactionID(tid).WithError(err).Errorf("%v - Error obtaining the combined message. Content couldn't get read. Message will be skipped.", tid)
-		return
+		partial, err := p.onCombineFailure(p.config.MetadataTopic, m.Headers, "", err, tid)
+		if partial == nil {
+			if err != nil {
+				logger.WithTransactionID(tid).WithError(err).Errorf("%v - Error obtaining the combined message. Content couldn't get read. Message will be skipped.", tid)
+			}
+			entry.skip("annotations could not be read")
+			return err
+		}
+		combinedMSG = *partial
+	}
+	rememberContent(p.State, &combinedMSG, tid)
+	return p.forward(m.Headers, &combinedMSG, entry, tid)
+}
+
+// forward treats messages filtered out by content type or suppressed as stale as handled.
+func (p *MsgProcessor) forward(headers map[string]string, combinedMSG *CombinedModel, entry *HistoryEntry, tid string) error {
+	entry.LastModified = combinedMSG.LastModified
+	entry.OutputTopic = p.Forwarder.Topic
+	if combinedMSG.MetadataStatus == MetadataFetchFailed {
+		entry.Reason = "forwarded without annotations"
+	}
+	err := p.Forwarder.filterAndForwardMsg(headers, combinedMSG, tid)
+	if err == InvalidContentTypeError || err == StaleContentError || err == UnchangedContentError {
+		entry.skip(skipReason(err, combinedMSG))
+		return nil
+	}
+	return err
+}
+
+func (p *MsgProcessor) whitelist() Whitelist {
+	if p.Whitelists != nil {
+		return p.Whitelists.Get()
 	}
-	p.Forwarder.filterAndForwardMsg(m.Headers, &combinedMSG, tid)
+	return Whitelist{ContentURIs: p.config.SupportedContentURIs, Origins: p.config.SupportedHeaders}
 }
 
 func extractTID(headers map[string]string) string {
@@ -165,8 +165,8 @@ func TestProcessContentMsg_Successfully_Forwarded(t *testing.T) {
 	}
 
 	expMsg := producer.Message{
-		Headers: m.Headers,
-		Body:    `{"uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b","content":{"title":"simple title","type":"Article","uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b"},"metadata":null,"contentUri":"http://wordpress-article-mapper/content/0cef259d-030d-497d-b4ef-e8fa0ee6db6b","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"false"}`,
+		Headers: combinedHeaders(m.Headers),
+		Body:    `{"schemaVersion":"2","uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b","content":{"title":"simple title","type":"Article","uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b"},"metadata":null,"contentUri":"http://wordpress-article-mapper/content/0cef259d-030d-497d-b4ef-e8fa0ee6db6b","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"false"}`,
 	}
 
 	dummyMsgProducer := DummyMsgProducer{t: t, expUUID: dummyDataCombiner.data.UUID, expMsg: expMsg}
@@ -183,6 +183,77 @@ func TestProcessContentMsg_Successfully_Forwarded(t *testing.T) {
 	assert.Equal(t, 1, len(hook.Entries))
 }
 
+func TestProcessContentMsg_Forwards_DocumentStoreLastModified(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1"}, "./testData/content-document-store-last-modified.json")
+	assert.NoError(t, err)
+
+	cm := &ContentMessage{}
+	err = json.Unmarshal([]byte(m.Body), cm)
+	assert.NoError(t, err)
+
+	dummyDataCombiner := DummyDataCombiner{
+		t:               t,
+		expectedContent: cm.ContentModel,
+		data: CombinedModel{
+			UUID:          "0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+			MarkedDeleted: "false",
+			LastModified:  cm.LastModified,
+			ContentURI:    cm.ContentURI,
+			Content:       cm.ContentModel,
+		},
+	}
+
+	expMsg := producer.Message{
+		Headers: combinedHeaders(m.Headers),
+		Body:    `{"schemaVersion":"2","uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b","content":{"title":"simple title","type":"Article","uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b"},"metadata":null,"contentUri":"http://wordpress-article-mapper/content/0cef259d-030d-497d-b4ef-e8fa0ee6db6b","lastModified":"2017-03-30T13:09:06.480+0000","markedDeleted":"false"}`,
+	}
+
+	dummyMsgProducer := DummyMsgProducer{t: t, expUUID: dummyDataCombiner.data.UUID, expMsg: expMsg}
+	config := MsgProcessorConfig{SupportedContentURIs: []string{"wordpress-article-mapper"}}
+	p := &MsgProcessor{config: config, DataCombiner: dummyDataCombiner, Forwarder: NewForwarder(dummyMsgProducer, []string{"Article"})}
+
+	hook := testLogger.NewTestHook("dummyDataCombiner")
+	p.processContentMsg(m)
+
+	assert.Equal(t, "info", hook.LastEntry().Level.String())
+	assert.Contains(t, hook.LastEntry().Message, fmt.Sprintf("%v - Mapped and sent for uuid: %v", m.Headers["X-Request-Id"], dummyDataCombiner.data.UUID))
+}
+
+func TestProcessContentMsg_DeadLettersWithTheConsumedHeaders(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "some-origin"}, "./testData/content.json")
+	assert.NoError(t, err)
+	consumed := cloneHeaders(m.Headers)
+	cm := &ContentMessage{}
+	assert.NoError(t, json.Unmarshal([]byte(m.Body), cm))
+
+	dummyDataCombiner := DummyDataCombiner{
+		t:               t,
+		expectedContent: cm.ContentModel,
+		data:            CombinedModel{UUID: "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", LastModified: "2017-03-30T13:09:06.48Z", Content: ContentModel{"uuid": "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", "type": "Article"}},
+	}
+	f := NewForwarder(&DummyDeadLetterProducer{err: errors.New("producer error")}, []string{"Article"})
+	f.OutputFormat = OutputFormatCloudEventsBinary
+	f.Compression = CompressionGzip
+	p := &MsgProcessor{config: MsgProcessorConfig{SupportedContentURIs: []string{"wordpress-article-mapper"}, ContentTopic: "PostPublicationEvents"}, DataCombiner: dummyDataCombiner, Forwarder: f}
+
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	kqc := KafkaQConsumer{Consumer: DummyConsumer{}, dest: ch, msgType: "PostPublicationEvents", policy: NewDeliveryPolicy(2, 0), deadLetter: NewDeadLetterQueue(dlq)}
+	go func() {
+		for km := range ch {
+			km.ack(p.processContentMsg(km.msg))
+		}
+	}()
+	kqc.ProcessMsg(m)
+	close(ch)
+
+	assert.Len(t, dlq.msgs, 1)
+	assert.Equal(t, m.Body, dlq.msgs[0].Body)
+	delete(dlq.msgs[0].Headers, DeadLetterSourceTopicHeader)
+	delete(dlq.msgs[0].Headers, DeadLetterReasonHeader)
+	assert.Equal(t, consumed, dlq.msgs[0].Headers, "the headers of the combined message shouldn't be dead-lettered")
+}
+
 func TestProcessContentMsg_DeleteEvent_Successfully_Forwarded(t *testing.T) {
 	testCases := map[string]struct {
 		Headers map[string]string
@@ -216,8 +287,8 @@ func TestProcessContentMsg_DeleteEvent_Successfully_Forwarded(t *testing.T) {
 				}}
 
 			expMsg := producer.Message{
-				Headers: m.Headers,
-				Body:    `{"uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b","contentUri":"http://wordpress-article-mapper/content/0cef259d-030d-497d-b4ef-e8fa0ee6db6b","markedDeleted":"true","lastModified":"2017-03-30T13:09:06.48Z","content":null,"metadata":null}`,
+				Headers: combinedHeaders(m.Headers),
+				Body:    `{"schemaVersion":"2","uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b","contentUri":"http://wordpress-article-mapper/content/0cef259d-030d-497d-b4ef-e8fa0ee6db6b","markedDeleted":"true","lastModified":"2017-03-30T13:09:06.48Z","content":null,"metadata":null}`,
 			}
 
 			dummyMsgProducer := DummyMsgProducer{t: t, expUUID: dummyDataCombiner.data.UUID, expMsg: expMsg}
@@ -371,8 +442,8 @@ func TestProcessMetadataMsg_Successfully_Forwarded(t *testing.T) {
 			},
 		}}
 	expMsg := producer.Message{
-		Headers: m.Headers,
-		Body:    `{"uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
+		Headers: combinedHeaders(m.Headers),
+		Body:    `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
 	}
 
 	dummyMsgProducer := DummyMsgProducer{t: t, expUUID: dummyDataCombiner.data.UUID, expMsg: expMsg}
@@ -389,6 +460,126 @@ func TestProcessMetadataMsg_Successfully_Forwarded(t *testing.T) {
 	assert.Equal(t, 1, len(hook.Entries))
 }
 
+func TestProcessMessages_AcknowledgesOutcome(t *testing.T) {
+	allowedUris := []string{"methode-article-mapper", "wordpress-article-mapper", "next-video-mapper", "upp-content-validator"}
+	config := MsgProcessorConfig{SupportedContentURIs: allowedUris, ContentTopic: "PostPublicationEvents", MetadataTopic: "PostConceptAnnotations"}
+
+	ch := make(chan *KafkaQMessage)
+	p := &MsgProcessor{src: ch, config: config}
+	go p.ProcessMessages()
+
+	unsupported, err := createMessage(map[string]string{"X-Request-Id": "some-tid1"}, "./testData/content-with-unsupported-uri.json")
+	assert.NoError(t, err)
+	km := newKafkaQMessage(config.ContentTopic, unsupported)
+	ch <- km
+	assert.NoError(t, <-km.done, "skipped messages should be acknowledged as handled")
+
+	km = newKafkaQMessage(config.ContentTopic, consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid2"}, Body: "body"})
+	ch <- km
+	err = <-km.done
+	assert.Error(t, err)
+	assert.True(t, IsPermanentError(err), "unparsable messages can't be fixed by redelivery")
+}
+
+func TestProcessContentMsg_CombinerErrorIsRetryable(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1"}, "./testData/content.json")
+	assert.NoError(t, err)
+
+	cm := &ContentMessage{}
+	err = json.Unmarshal([]byte(m.Body), cm)
+	assert.NoError(t, err)
+
+	allowedUris := []string{"methode-article-mapper", "wordpress-article-mapper", "next-video-mapper", "upp-content-validator"}
+	config := MsgProcessorConfig{SupportedContentURIs: allowedUris}
+	dummyDataCombiner := DummyDataCombiner{t: t, expectedContent: cm.ContentModel, err: errors.New("some error")}
+	p := &MsgProcessor{config: config, DataCombiner: dummyDataCombiner}
+
+	err = p.processContentMsg(m)
+	assert.EqualError(t, err, "some error")
+	assert.False(t, IsPermanentError(err))
+}
+
+func TestProcessMetadataMsg_FilteredContentTypeIsHandled(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "http://cmdb.ft.com/systems/binding-service"}, "./testData/annotations.json")
+	assert.NoError(t, err)
+
+	am := &AnnotationsMessage{}
+	err = json.Unmarshal([]byte(m.Body), am)
+	assert.NoError(t, err)
+
+	config := MsgProcessorConfig{SupportedHeaders: []string{"http://cmdb.ft.com/systems/binding-service"}}
+	dummyDataCombiner := DummyDataCombiner{t: t, expectedMetadata: *am, data: CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Content"}}}
+	p := &MsgProcessor{config: config, DataCombiner: dummyDataCombiner, Forwarder: NewForwarder(DummyMsgProducer{t: t}, []string{"Article"})}
+
+	assert.NoError(t, p.processMetadataMsg(m))
+}
+
+func TestFilterAndForwardMsg_UntypedContent(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+
+	untyped := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid"}}
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &untyped, "some-tid1"))
+	assert.Len(t, producer.msgs, 1)
+
+	f.AllowUntypedContent = false
+	assert.Equal(t, InvalidContentTypeError, f.filterAndForwardMsg(map[string]string{}, &untyped, "some-tid2"))
+	assert.Len(t, producer.msgs, 1)
+}
+
+func TestProcessMetadataMsg_StaleContentForwardedWithMarker(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "http://cmdb.ft.com/systems/binding-service"}, "./testData/annotations.json")
+	assert.NoError(t, err)
+
+	am := &AnnotationsMessage{}
+	err = json.Unmarshal([]byte(m.Body), am)
+	assert.NoError(t, err)
+
+	config := MsgProcessorConfig{
+		SupportedHeaders: []string{"http://cmdb.ft.com/systems/binding-service"},
+		StalePolicy:      StalePolicy{Action: StaleActionForward},
+	}
+	dummyDataCombiner := DummyDataCombiner{
+		t:                t,
+		expectedMetadata: *am,
+		data:             CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:01Z", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}},
+	}
+	producer := &RecordingMsgProducer{}
+	p := &MsgProcessor{config: config, DataCombiner: dummyDataCombiner, Forwarder: NewForwarder(producer, []string{"Article"})}
+	advanceWatermark(p.Forwarder.Watermarks, "some_uuid", "2017-03-30T13:09:06.48Z")
+
+	assert.NoError(t, p.processMetadataMsg(m))
+	assert.Len(t, producer.msgs, 1)
+	assert.Contains(t, producer.msgs[0].Body, `"stale":true`)
+}
+
+func TestProcessMetadataMsg_StaleContentRetriesExhausted(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "http://cmdb.ft.com/systems/binding-service"}, "./testData/annotations.json")
+	assert.NoError(t, err)
+
+	am := &AnnotationsMessage{}
+	err = json.Unmarshal([]byte(m.Body), am)
+	assert.NoError(t, err)
+
+	config := MsgProcessorConfig{
+		SupportedHeaders: []string{"http://cmdb.ft.com/systems/binding-service"},
+		StalePolicy:      StalePolicy{Action: StaleActionRetry, MaxRetries: 1},
+	}
+	dummyDataCombiner := DummyDataCombiner{
+		t:                t,
+		expectedMetadata: *am,
+		data:             CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:01Z", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}},
+	}
+	producer := &RecordingMsgProducer{}
+	p := &MsgProcessor{config: config, DataCombiner: dummyDataCombiner, Forwarder: NewForwarder(producer, []string{"Article"})}
+	advanceWatermark(p.Forwarder.Watermarks, "some_uuid", "2017-03-30T13:09:06.48Z")
+
+	err = p.processMetadataMsg(m)
+	assert.Equal(t, StaleReadError, err)
+	assert.False(t, IsPermanentError(err), "the message should be redelivered")
+	assert.Empty(t, producer.msgs)
+}
+
 func TestForwardMsg(t *testing.T) {
 
 	tests := []struct {
@@ -402,7 +593,7 @@ func TestForwardMsg(t *testing.T) {
 				"X-Request-Id": "some-tid1",
 			},
 			uuid: "uuid1",
-			body: `{"uuid":"uuid1","content":{"uuid":"","title":"","body":"","identifiers":null,"publishedDate":"","lastModified":"","firstPublishedDate":"","mediaType":"","byline":"","standfirst":"","description":"","mainImage":"","publishReference":"","type":""},"metadata":null,"contentUri":"","lastModified":"","markedDeleted":"false"}`,
+			body: `{"schemaVersion":"2","uuid":"uuid1","content":{"uuid":"","title":"","body":"","identifiers":null,"publishedDate":"","lastModified":"","firstPublishedDate":"","mediaType":"","byline":"","standfirst":"","description":"","mainImage":"","publishReference":"","type":""},"metadata":null,"contentUri":"","lastModified":"","markedDeleted":"false"}`,
 			err:  nil,
 		},
 		{
@@ -410,7 +601,7 @@ func TestForwardMsg(t *testing.T) {
 				"X-Request-Id": "some-tid2",
 			},
 			uuid: "uuid-returning-error",
-			body: `{"uuid":"uuid-returning-error","content":{"uuid":"","title":"","body":"","identifiers":null,"publishedDate":"","lastModified":"","firstPublishedDate":"","mediaType":"","byline":"","standfirst":"","description":"","mainImage":"","publishReference":"","type":""},"metadata":null}`,
+			body: `{"schemaVersion":"2","uuid":"uuid-returning-error","content":{"uuid":"","title":"","body":"","identifiers":null,"publishedDate":"","lastModified":"","firstPublishedDate":"","mediaType":"","byline":"","standfirst":"","description":"","mainImage":"","publishReference":"","type":""},"metadata":null}`,
 			err:  fmt.Errorf("Some error"),
 		},
 	}
@@ -552,6 +743,14 @@ func (p DummyMsgProducer) ConnectivityCheck() (string, error) {
 	return "", nil
 }
 
+// combinedHeaders are the headers of the combined message forwarded for a message with the headers.
+func combinedHeaders(headers map[string]string) map[string]string {
+	combined := cloneHeaders(headers)
+	combined["Message-Type"] = CombinerMessageType
+	combined[SchemaVersionHeader] = CombinedSchemaVersion
+	return combined
+}
+
 type DummyDataCombiner struct {
 	t                *testing.T
 	expectedContent  ContentModel
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"sync"
+	"time"
+)
+
+// orderingGuard serialises forwarding per UUID, so that the watermark check and the send happen atomically.
+type orderingGuard struct {
+	sync.Mutex
+	inFlight map[string]*uuidLock
+}
+
+type uuidLock struct {
+	sync.Mutex
+	holders int
+}
+
+func newOrderingGuard() *orderingGuard {
+	return &orderingGuard{inFlight: make(map[string]*uuidLock)}
+}
+
+// lock serialises forwarding for the given UUID. The returned function releases the lock.
+func (g *orderingGuard) lock(uuid string) func() {
+	g.Lock()
+	l, ok := g.inFlight[uuid]
+	if !ok {
+		l = &uuidLock{}
+		g.inFlight[uuid] = l
+	}
+	l.holders++
+	g.Unlock()
+
+	l.Lock()
+	return func() {
+		g.Lock()
+		l.holders--
+		if l.holders == 0 {
+			delete(g.inFlight, uuid)
+		}
+		g.Unlock()
+		l.Unlock()
+	}
+}
+
+// isOlderThanWatermark reports whether lastModified is older than the last forwarded one for the UUID.
+// Messages without a parsable lastModified can't be ordered and are never considered older.
+func isOlderThanWatermark(watermarks WatermarkStore, uuid string, lastModified string) bool {
+	t, ok := parseLastModified(lastModified)
+	if !ok {
+		return false
+	}
+	watermark, ok := watermarks.Get(uuid)
+	return ok && t.Before(watermark)
+}
+
+func advanceWatermark(watermarks WatermarkStore, uuid string, lastModified string) {
+	if t, ok := parseLastModified(lastModified); ok {
+		watermarks.Advance(uuid, t)
+	}
+}
+
+func parseLastModified(lastModified string) (time.Time, bool) {
+	if lastModified == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, lastModified)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,152 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	testLogger "github.com/Financial-Times/go-logger/test"
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsOlderThanWatermark(t *testing.T) {
+	watermarks := NewWatermarkStore(NewInMemoryStateStore(10, 0))
+	advanceWatermark(watermarks, "uuid1", "2017-03-30T13:09:06.48Z")
+	advanceWatermark(watermarks, "uuid3", "not a date")
+
+	tests := []struct {
+		uuid         string
+		lastModified string
+		expOlder     bool
+	}{
+		{"uuid1", "2017-03-30T13:09:05.48Z", true},
+		{"uuid1", "2017-03-30T13:09:06.48Z", false},
+		{"uuid1", "2017-03-30T13:09:07Z", false},
+		{"uuid1", "", false},
+		{"uuid1", "not a date", false},
+		{"uuid2", "2017-03-30T13:09:05.48Z", false},
+		{"uuid3", "2017-03-30T13:09:05.48Z", false},
+	}
+
+	for _, testCase := range tests {
+		assert.Equal(t, testCase.expOlder, isOlderThanWatermark(watermarks, testCase.uuid, testCase.lastModified), fmt.Sprintf("uuid=%v lastModified=%v", testCase.uuid, testCase.lastModified))
+	}
+}
+
+func TestOrderingGuardSerialisesPerUUID(t *testing.T) {
+	g := newOrderingGuard()
+
+	unlock := g.lock("uuid1")
+	acquired := make(chan struct{})
+	released := make(chan struct{})
+	go func() {
+		secondUnlock := g.lock("uuid1")
+		close(acquired)
+		secondUnlock()
+		close(released)
+	}()
+
+	otherUnlock := g.lock("uuid2")
+	otherUnlock()
+
+	select {
+	case <-acquired:
+		t.Fatal("the lock for uuid1 shouldn't be acquired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	<-acquired
+	<-released
+	g.Lock()
+	defer g.Unlock()
+	assert.Empty(t, g.inFlight)
+}
+
+func TestFilterAndForwardMsg_SuppressesStaleMessages(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+
+	newer := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:06.48Z", Content: ContentModel{"type": "Article"}}
+	older := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:05.48Z", Content: ContentModel{"type": "Article"}}
+
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &newer, "some-tid1"))
+
+	hook := testLogger.NewTestHook("combiner")
+	assert.Equal(t, StaleContentError, f.filterAndForwardMsg(map[string]string{}, &older, "some-tid2"))
+	assert.Equal(t, "warning", hook.LastEntry().Level.String())
+	assert.Contains(t, hook.LastEntry().Message, "some-tid2 - Skipped stale combined message with lastModified: 2017-03-30T13:09:05.48Z")
+
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &newer, "some-tid3"), "republishing the same version should be allowed")
+	assert.Equal(t, []string{"uuid1", "uuid1"}, producer.keys)
+}
+
+func TestFilterAndForwardMsg_ForwardsMessagesMarkedStale(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+
+	newer := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:06.48Z", Content: ContentModel{"type": "Article"}}
+	older := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:05.48Z", Content: ContentModel{"type": "Article"}, Stale: true}
+
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &newer, "some-tid1"))
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{}, &older, "some-tid2"))
+	assert.Contains(t, producer.msgs[1].Body, `"stale":true`)
+
+	watermark, _ := f.Watermarks.Get("uuid1")
+	assert.Equal(t, "2017-03-30T13:09:06.48Z", watermark.Format(time.RFC3339Nano), "stale messages shouldn't move the watermark back")
+}
+
+func TestFilterAndForwardMsg_ConcurrentForwardsStayOrdered(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+
+	base, _ := time.Parse(time.RFC3339Nano, "2017-03-30T13:09:06.48Z")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := CombinedModel{UUID: "uuid1", LastModified: base.Add(time.Duration(i) * time.Second).Format(time.RFC3339Nano), Content: ContentModel{"type": "Article"}}
+			f.filterAndForwardMsg(map[string]string{}, &m, "some-tid")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < len(producer.lastModified); i++ {
+		assert.False(t, producer.lastModified[i].Before(producer.lastModified[i-1]), "combined messages were forwarded out of order")
+	}
+}
+
+type RecordingMsgProducer struct {
+	sync.Mutex
+	keys         []string
+	msgs         []producer.Message
+	lastModified []time.Time
+	err          error
+}
+
+func (p *RecordingMsgProducer) SendMessage(uuid string, m producer.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.keys = append(p.keys, uuid)
+	p.msgs = append(p.msgs, m)
+	// binary encoded bodies are recorded, without their lastModified
+	var cm CombinedModel
+	if err := json.Unmarshal([]byte(m.Body), &cm); err != nil {
+		return nil
+	}
+	if t, ok := parseLastModified(cm.LastModified); ok {
+		p.lastModified = append(p.lastModified, t)
+	}
+	return nil
+}
+
+func (p *RecordingMsgProducer) ConnectivityCheck() (string, error) {
+	return "", nil
+}
@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/dchest/uniuri"
+)
+
+const (
+	FailureActionDrop    = "drop"
+	FailureActionRetry   = "retry"
+	FailureActionForward = "forward"
+
+	DefaultRecombineInterval = 30 * time.Second
+	// bounds the memory used during long annotations outages
+	maxPendingRecombines = 100000
+)
+
+// MetadataFetchError is returned when the content was read, but the annotations couldn't be.
+// Model is the combined message without annotations, marked as such.
+type MetadataFetchError struct {
+	Model CombinedModel
+	Err   error
+}
+
+func newMetadataFetchError(uuid string, content ContentModel, err error) *MetadataFetchError {
+	return &MetadataFetchError{
+		Model: CombinedModel{
+			UUID:           uuid,
+			Content:        content,
+			MetadataStatus: MetadataFetchFailed,
+			LastModified:   content.getLastModified(),
+		},
+		Err: err,
+	}
+}
+
+func (e *MetadataFetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MetadataFetchError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateFailureAction checks the action taken when the annotations of a message can't be read.
+func ValidateFailureAction(action string) error {
+	switch action {
+	case FailureActionDrop, FailureActionRetry, FailureActionForward:
+		return nil
+	}
+	return fmt.Errorf("unknown failure action %q, expected one of %q, %q or %q", action, FailureActionDrop, FailureActionRetry, FailureActionForward)
+}
+
+// onCombineFailure applies the failure policy of the topic to combines that couldn't read the annotations.
+// It returns the combined message to forward, or the error to acknowledge the message with when there's none.
+func (p *MsgProcessor) onCombineFailure(topic string, headers map[string]string, contentURI string, err error, tid string) (*CombinedModel, error) {
+	var metadataErr *MetadataFetchError
+	if !errors.As(err, &metadataErr) {
+		return nil, err
+	}
+
+	switch p.config.FailurePolicies[topic] {
+	case FailureActionDrop:
+		logger.WithTransactionID(tid).WithUUID(metadataErr.Model.UUID).WithError(err).Warnf("%v - Annotations could not be read, the message is dropped.", tid)
+		return nil, nil
+	case FailureActionForward:
+		logger.WithTransactionID(tid).WithUUID(metadataErr.Model.UUID).WithError(err).Warnf("%v - Annotations could not be read, the content is forwarded without them.", tid)
+		model := metadataErr.Model
+		model.ContentURI = contentURI
+		if p.Recombiner != nil {
+			p.Recombiner.Schedule(model.UUID, contentURI, headers)
+		}
+		return &model, nil
+	}
+	return nil, err
+}
+
+// Recombiner combines again the content forwarded without annotations, once public-annotations-api recovers.
+type Recombiner struct {
+	sync.Mutex
+	DataCombiner DataCombinerI
+	Forwarder    *Forwarder
+	Interval     time.Duration
+	pending      map[string]pendingRecombine
+	stop         chan struct{}
+}
+
+type pendingRecombine struct {
+	contentURI string
+	headers    map[string]string
+}
+
+func NewRecombiner(dataCombiner DataCombinerI, forwarder *Forwarder, interval time.Duration) *Recombiner {
+	if interval <= 0 {
+		interval = DefaultRecombineInterval
+	}
+	return &Recombiner{
+		DataCombiner: dataCombiner,
+		Forwarder:    forwarder,
+		Interval:     interval,
+		pending:      make(map[string]pendingRecombine),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Schedule records the UUID to be combined again, with the headers of the message that triggered the combine.
+func (r *Recombiner) Schedule(uuid string, contentURI string, headers map[string]string) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.pending[uuid]; !ok && len(r.pending) >= maxPendingRecombines {
+		logger.WithField("uuid", uuid).Warn("Too many pending recombines, the content won't be combined again with its annotations")
+		return
+	}
+
+	h := make(map[string]string, len(headers))
+	for k, v := range headers {
+		h[k] = v
+	}
+	r.pending[uuid] = pendingRecombine{contentURI: contentURI, headers: h}
+}
+
+func (r *Recombiner) Pending() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.pending)
+}
+
+func (r *Recombiner) Start() {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.recombinePending()
+		}
+	}
+}
+
+func (r *Recombiner) Stop() {
+	close(r.stop)
+}
+
+// recombinePending combines the pending UUIDs again. The ones whose annotations still can't be read stay pending.
+func (r *Recombiner) recombinePending() {
+	r.Lock()
+	pending := r.pending
+	r.pending = make(map[string]pendingRecombine)
+	r.Unlock()
+
+	for uuid, recombine := range pending {
+		tid := "tid_recombine_" + uniuri.NewLen(10) + "_post_publication_combiner"
+		headers := recombine.headers
+		headers["X-Request-Id"] = tid
+
+		combinedMSG, err := r.DataCombiner.GetCombinedModel(uuid)
+		var metadataErr *MetadataFetchError
+		if errors.As(err, &metadataErr) {
+			r.Schedule(uuid, recombine.contentURI, headers)
+			continue
+		}
+		if err != nil {
+			// the content itself can't be read anymore, later updates will be combined as usual
+			logger.WithTransactionID(tid).WithUUID(uuid).WithError(err).Errorf("%v - Error combining the content again with its annotations.", tid)
+			continue
+		}
+		if combinedMSG.Content == nil {
+			// the content was deleted in the meantime, and the delete already forwarded
+			logger.WithTransactionID(tid).WithUUID(uuid).Infof("%v - Skipped combining the content again, as it was deleted.", tid)
+			continue
+		}
+
+		combinedMSG.ContentURI = recombine.contentURI
+		combinedMSG.MarkedDeleted = "false"
+		err = r.Forwarder.filterAndForwardMsg(headers, &combinedMSG, tid)
+		if err != nil && err != InvalidContentTypeError && err != StaleContentError && err != UnchangedContentError && !IsPermanentError(err) {
+			r.Schedule(uuid, recombine.contentURI, headers)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataCombiner_MetadataFetchError(t *testing.T) {
+	combiner := DataCombiner{
+		ContentRetriever:  DummyContentRetriever{ContentModel{"uuid": "some_uuid", "lastModified": "2017-03-30T13:09:06.48Z"}, nil},
+		MetadataRetriever: DummyMetadataRetriever{nil, errors.New("some error")},
+	}
+
+	_, err := combiner.GetCombinedModel("some_uuid")
+	var metadataErr *MetadataFetchError
+	assert.True(t, errors.As(err, &metadataErr))
+	assert.Equal(t, "some error", err.Error())
+	assert.Equal(t, CombinedModel{
+		UUID:           "some_uuid",
+		Content:        ContentModel{"uuid": "some_uuid", "lastModified": "2017-03-30T13:09:06.48Z"},
+		MetadataStatus: MetadataFetchFailed,
+		LastModified:   "2017-03-30T13:09:06.48Z",
+	}, metadataErr.Model)
+
+	combiner.ContentRetriever = DummyContentRetriever{nil, errors.New("some error")}
+	_, err = combiner.GetCombinedModel("some_uuid")
+	assert.False(t, errors.As(err, &metadataErr), "content failures should fail the whole combine")
+}
+
+func TestValidateFailureAction(t *testing.T) {
+	assert.NoError(t, ValidateFailureAction(FailureActionDrop))
+	assert.NoError(t, ValidateFailureAction(FailureActionRetry))
+	assert.NoError(t, ValidateFailureAction(FailureActionForward))
+	assert.Error(t, ValidateFailureAction("ignore"))
+}
+
+func TestProcessContentMsg_AnnotationsFailurePolicy(t *testing.T) {
+	const uuid = "0cef259d-030d-497d-b4ef-e8fa0ee6db6b"
+	content := ContentModel{"uuid": uuid, "type": "Article", "lastModified": "2017-03-30T13:09:06.48Z"}
+	fetchErr := newMetadataFetchError(uuid, content, errors.New("some error"))
+
+	tests := map[string]struct {
+		action       string
+		expErr       bool
+		expForward   bool
+		expRecombine int
+	}{
+		"Retry by default": {action: "", expErr: true},
+		"Retry":            {action: FailureActionRetry, expErr: true},
+		"Drop":             {action: FailureActionDrop},
+		"Forward":          {action: FailureActionForward, expForward: true, expRecombine: 1},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1"}, "./testData/content.json")
+			assert.NoError(t, err)
+			cm := &ContentMessage{}
+			assert.NoError(t, json.Unmarshal([]byte(m.Body), cm))
+
+			producer := &RecordingMsgProducer{}
+			p := &MsgProcessor{
+				config: MsgProcessorConfig{
+					SupportedContentURIs: []string{"wordpress-article-mapper"},
+					ContentTopic:         "PostPublicationEvents",
+					FailurePolicies:      map[string]string{"PostPublicationEvents": test.action},
+				},
+				DataCombiner: DummyDataCombiner{t: t, expectedContent: cm.ContentModel, err: fetchErr},
+				Forwarder:    NewForwarder(producer, []string{"Article"}),
+			}
+			p.Recombiner = NewRecombiner(p.DataCombiner, &p.Forwarder, 0)
+
+			err = p.processContentMsg(m)
+			if test.expErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expRecombine, p.Recombiner.Pending())
+			if !test.expForward {
+				assert.Empty(t, producer.msgs)
+				return
+			}
+
+			assert.Len(t, producer.msgs, 1)
+			var forwarded CombinedModel
+			assert.NoError(t, json.Unmarshal([]byte(producer.msgs[0].Body), &forwarded))
+			assert.Equal(t, MetadataFetchFailed, forwarded.MetadataStatus)
+			assert.Nil(t, forwarded.Metadata)
+			assert.Equal(t, "false", forwarded.MarkedDeleted)
+			assert.Equal(t, cm.ContentURI, forwarded.ContentURI)
+		})
+	}
+}
+
+func TestRecombiner_RecombinesOnceAnnotationsAreAvailable(t *testing.T) {
+	const uuid = "0cef259d-030d-497d-b4ef-e8fa0ee6db6b"
+	content := ContentModel{"uuid": uuid, "type": "Article", "lastModified": "2017-03-30T13:09:06.48Z"}
+	producer := &RecordingMsgProducer{}
+	forwarder := NewForwarder(producer, []string{"Article"})
+
+	r := NewRecombiner(DummyDataCombiner{t: t, expectedUUID: uuid, err: newMetadataFetchError(uuid, content, errors.New("some error"))}, &forwarder, 0)
+	r.Schedule(uuid, "http://wordpress-article-mapper/content/"+uuid, map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "http://cmdb.ft.com/systems/wordpress"})
+
+	r.recombinePending()
+	assert.Equal(t, 1, r.Pending(), "the uuid should stay pending while the annotations can't be read")
+	assert.Empty(t, producer.msgs)
+
+	r.DataCombiner = DummyDataCombiner{t: t, expectedUUID: uuid, data: CombinedModel{
+		UUID:           uuid,
+		Content:        content,
+		Metadata:       []Annotation{{Thing{ID: "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}},
+		MetadataStatus: MetadataPresent,
+		LastModified:   "2017-03-30T13:09:06.48Z",
+	}}
+	r.recombinePending()
+	assert.Equal(t, 0, r.Pending())
+
+	assert.Len(t, producer.msgs, 1)
+	assert.Equal(t, "http://cmdb.ft.com/systems/wordpress", producer.msgs[0].Headers["Origin-System-Id"])
+	assert.Contains(t, producer.msgs[0].Headers["X-Request-Id"], "tid_recombine_")
+	var forwarded CombinedModel
+	assert.NoError(t, json.Unmarshal([]byte(producer.msgs[0].Body), &forwarded))
+	assert.Equal(t, MetadataPresent, forwarded.MetadataStatus)
+	assert.Equal(t, "http://wordpress-article-mapper/content/"+uuid, forwarded.ContentURI)
+	assert.Equal(t, "false", forwarded.MarkedDeleted)
+}
+
+func TestRecombiner_GivesUpWhenContentCantBeRead(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	forwarder := NewForwarder(producer, []string{"Article"})
+
+	r := NewRecombiner(DummyDataCombiner{t: t, expectedUUID: "some_uuid", err: errors.New("some error")}, &forwarder, 0)
+	r.Schedule("some_uuid", "", map[string]string{})
+	r.recombinePending()
+
+	assert.Equal(t, 0, r.Pending())
+	assert.Empty(t, producer.msgs)
+}
+
+func TestRecombiner_SkipsContentDeletedWhilePending(t *testing.T) {
+	const uuid = "0cef259d-030d-497d-b4ef-e8fa0ee6db6b"
+	producer := &RecordingMsgProducer{}
+	forwarder := NewForwarder(producer, []string{"Article"})
+
+	r := NewRecombiner(DummyDataCombiner{t: t, expectedUUID: uuid, data: CombinedModel{
+		UUID:           uuid,
+		Metadata:       []Annotation{{Thing{ID: "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}},
+		MetadataStatus: MetadataPresent,
+	}}, &forwarder, 0)
+	r.Schedule(uuid, "http://wordpress-article-mapper/content/"+uuid, map[string]string{"X-Request-Id": "some-tid1"})
+	r.recombinePending()
+
+	assert.Equal(t, 0, r.Pending())
+	assert.Empty(t, producer.msgs, "the content deleted shouldn't be forwarded as not deleted")
+}
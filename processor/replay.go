@@ -0,0 +1,60 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+)
+
+// maxCapturedMessageBytes bounds the length of a line of a captured messages file.
+const maxCapturedMessageBytes = 16 * 1024 * 1024
+
+// CapturedMessage is a consumed message, as captured for replays. Topic is only needed for messages not read from the replayed topic.
+type CapturedMessage struct {
+	consumer.Message
+	Topic string `json:",omitempty"`
+}
+
+type ReplayStats struct {
+	Processed int
+	Failed    int
+}
+
+// Replay feeds the messages captured as JSON lines in r to the processor, one at a time, and waits for each of them to be processed, as the consumers do.
+// Failed messages are logged and counted, they are neither redelivered nor dead-lettered.
+func Replay(r io.Reader, topic string, dest chan<- *KafkaQMessage) (ReplayStats, error) {
+	var stats ReplayStats
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxCapturedMessageBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var cm CapturedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &cm); err != nil {
+			return stats, fmt.Errorf("could not read the captured message on line %d: %v", line, err)
+		}
+		if cm.Headers == nil {
+			cm.Headers = map[string]string{}
+		}
+		if cm.Topic == "" {
+			cm.Topic = topic
+		}
+
+		km := newKafkaQMessage(cm.Topic, cm.Message)
+		dest <- km
+		if err := <-km.done; err != nil {
+			logger.WithTransactionID(cm.Headers["X-Request-Id"]).WithError(err).Errorf("Replay of the message on line %d from %v failed", line, cm.Topic)
+			stats.Failed++
+			continue
+		}
+		stats.Processed++
+	}
+	return stats, scanner.Err()
+}
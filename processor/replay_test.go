@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	captured := `{"Headers":{"X-Request-Id":"some-tid1"},"Body":"content"}
+
+{"Headers":{"X-Request-Id":"some-tid2"},"Body":"annotations","Topic":"PostConceptAnnotations"}
+{"Body":"failing"}
+`
+	ch := make(chan *KafkaQMessage)
+	var replayed []*KafkaQMessage
+	go func() {
+		for km := range ch {
+			replayed = append(replayed, km)
+			if km.msg.Body == "failing" {
+				km.ack(errors.New("some error"))
+				continue
+			}
+			km.ack(nil)
+		}
+	}()
+
+	stats, err := Replay(strings.NewReader(captured), "PostPublicationEvents", ch)
+	close(ch)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayStats{Processed: 2, Failed: 1}, stats)
+	assert.Len(t, replayed, 3)
+	assert.Equal(t, "PostPublicationEvents", replayed[0].msgType)
+	assert.Equal(t, "some-tid1", replayed[0].msg.Headers["X-Request-Id"])
+	assert.Equal(t, "PostConceptAnnotations", replayed[1].msgType)
+	assert.Equal(t, "annotations", replayed[1].msg.Body)
+	assert.NotNil(t, replayed[2].msg.Headers)
+}
+
+func TestReplay_InvalidLine(t *testing.T) {
+	_, err := Replay(strings.NewReader("not json\n"), "PostPublicationEvents", make(chan *KafkaQMessage))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 1")
+}
@@ -2,43 +2,76 @@ package processor
 
 import (
 	"github.com/Financial-Times/go-logger"
-	"github.com/Financial-Times/message-queue-go-producer/producer"
 	"github.com/dchest/uniuri"
 )
 
 const (
 	CombinerOrigin = "forced-combined-msg"
 	ContentType    = "application/json"
+	// ForcedByHeader names the authenticated caller who forced the message
+	ForcedByHeader = "X-Forced-By"
 )
 
 type RequestProcessorI interface {
-	ForceMessagePublish(uuid string, tid string) error
+	ForceMessagePublish(uuid string, tid string, caller string) error
 }
 
 type RequestProcessor struct {
 	DataCombiner DataCombinerI
 	Forwarder    Forwarder
+	StalePolicy  StalePolicy
+	State        StateStore
+	History      *History
+	// Limits rejects the force requests over the rate limits, or processed at once over the cap
+	Limits *ForceLimits
 }
 
-func NewRequestProcessor(dataCombiner DataCombinerI, producer producer.MessageProducer, whitelistedContentTypes []string) *RequestProcessor {
-	return &RequestProcessor{DataCombiner: dataCombiner, Forwarder: NewForwarder(producer, whitelistedContentTypes)}
+func NewRequestProcessor(dataCombiner DataCombinerI, sink Sink, whitelistedContentTypes []string) *RequestProcessor {
+	return &RequestProcessor{DataCombiner: dataCombiner, Forwarder: NewForwarder(sink, whitelistedContentTypes)}
 }
 
-func (p *RequestProcessor) ForceMessagePublish(uuid string, tid string) error {
+// ForceMessagePublish combines and forwards the content, for the caller when the request was authenticated.
+func (p *RequestProcessor) ForceMessagePublish(uuid string, tid string, caller string) (err error) {
 
 	if tid == "" {
 		tid = "tid_force_publish" + uniuri.NewLen(10) + "_post_publication_combiner"
 		logger.WithTransactionID(tid).WithUUID(uuid).Infof("Generated tid: %s", tid)
 	}
 
+	release, err := p.Limits.Acquire(caller)
+	if err != nil {
+		logger.WithTransactionID(tid).WithUUID(uuid).WithError(err).Warnf("%v - Force request rejected for caller %q", tid, caller)
+		return err
+	}
+	defer release()
+
 	h := map[string]string{
 		"X-Request-Id":     tid,
 		"Content-Type":     ContentType,
 		"Origin-System-Id": CombinerOrigin,
 	}
+	if caller != "" {
+		h[ForcedByHeader] = caller
+		logger.WithTransactionID(tid).WithUUID(uuid).Infof("%v - Force publish requested by %v", tid, caller)
+	}
+	entry := newHistoryEntry(ForceRequestSource, h, tid)
+	entry.UUID = uuid
+	entry.Caller = caller
+	entry.OutputTopic = p.Forwarder.Topic
+	var combinedMSG CombinedModel
+	defer func() {
+		if err == InvalidContentTypeError || err == StaleContentError {
+			entry.skip(skipReason(err, &combinedMSG))
+			p.History.Record(entry, nil)
+			return
+		}
+		p.History.Record(entry, err)
+	}()
 
 	//get combined message
-	combinedMSG, err := p.DataCombiner.GetCombinedModel(uuid)
+	combinedMSG, err = combineWithStalePolicy(func() (CombinedModel, error) {
+		return p.DataCombiner.GetCombinedModel(uuid)
+	}, p.Forwarder.Watermarks, p.StalePolicy, tid)
 	if err != nil {
 		logger.WithTransactionID(tid).WithUUID(uuid).WithError(err).Errorf("%v - Error obtaining the combined message, it will be skipped.", tid)
 		return err
@@ -50,6 +83,9 @@ func (p *RequestProcessor) ForceMessagePublish(uuid string, tid string) error {
 		return err
 	}
 
+	rememberContent(p.State, &combinedMSG, tid)
+	entry.LastModified = combinedMSG.LastModified
+
 	//forward data
 	return p.Forwarder.filterAndForwardMsg(h, &combinedMSG, tid)
 }
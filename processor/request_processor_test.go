@@ -38,8 +38,8 @@ func TestForceMessageWithTID(t *testing.T) {
 		}}
 	tid := "transaction_id_1"
 	expMsg := producer.Message{
-		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": tid, "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType},
-		Body:    `{"uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
+		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": tid, "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType, SchemaVersionHeader: CombinedSchemaVersion},
+		Body:    `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
 	}
 
 	dummyMsgProducer := DummyMsgProducer{t: t, expUUID: testUUID, expTID: tid, expMsg: expMsg}
@@ -49,7 +49,7 @@ func TestForceMessageWithTID(t *testing.T) {
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
 
-	err := p.ForceMessagePublish(testUUID, tid)
+	err := p.ForceMessagePublish(testUUID, tid, "")
 	assert.NoError(t, err)
 
 	assert.Equal(t, "info", hook.LastEntry().Level.String())
@@ -86,8 +86,8 @@ func TestForceMessageWithoutTID(t *testing.T) {
 
 	emptyTID := ""
 	expMsg := producer.Message{
-		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType},
-		Body:    `{"uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
+		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType, SchemaVersionHeader: CombinedSchemaVersion},
+		Body:    `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
 	}
 
 	dummyMsgProducer := DummyMsgProducer{t: t, expUUID: testUUID, expMsg: expMsg}
@@ -97,7 +97,7 @@ func TestForceMessageWithoutTID(t *testing.T) {
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
 
-	err := p.ForceMessagePublish(testUUID, emptyTID)
+	err := p.ForceMessagePublish(testUUID, emptyTID, "")
 	assert.NoError(t, err)
 
 	assert.Equal(t, "info", hook.LastEntry().Level.String())
@@ -109,8 +109,8 @@ func TestForceMessageCombinerError(t *testing.T) {
 	allowedContentTypes := []string{"Article", "Video"}
 	combiner := DummyDataCombiner{t: t, err: errors.New("some error")}
 	expMsg := producer.Message{
-		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType},
-		Body:    `{"uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
+		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType, SchemaVersionHeader: CombinedSchemaVersion},
+		Body:    `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
 	}
 	dummyMsgProducer := DummyMsgProducer{t: t, expUUID: combiner.data.UUID, expMsg: expMsg}
 	p := &RequestProcessor{DataCombiner: combiner, Forwarder: NewForwarder(dummyMsgProducer, allowedContentTypes)}
@@ -119,7 +119,7 @@ func TestForceMessageCombinerError(t *testing.T) {
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
 
-	err := p.ForceMessagePublish(combiner.data.UUID, "")
+	err := p.ForceMessagePublish(combiner.data.UUID, "", "")
 	assert.Equal(t, combiner.err, err)
 
 	assert.Equal(t, "error", hook.LastEntry().Level.String())
@@ -132,8 +132,8 @@ func TestForceMessageNotFoundError(t *testing.T) {
 
 	allowedContentTypes := []string{"Article", "Video"}
 	expMsg := producer.Message{
-		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType},
-		Body:    `{"uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
+		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType, SchemaVersionHeader: CombinedSchemaVersion},
+		Body:    `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
 	}
 	testUUID := "some_uuid"
 	combiner := DummyDataCombiner{t: t, expectedUUID: testUUID}
@@ -144,7 +144,7 @@ func TestForceMessageNotFoundError(t *testing.T) {
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
 
-	err := p.ForceMessagePublish(testUUID, "")
+	err := p.ForceMessagePublish(testUUID, "", "")
 	assert.Equal(t, NotFoundError, err)
 
 	assert.Equal(t, "error", hook.LastEntry().Level.String())
@@ -181,8 +181,8 @@ func TestForceMessage_FilteringError(t *testing.T) {
 			},
 		}}
 	expMsg := producer.Message{
-		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType},
-		Body:    `{"uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
+		Headers: map[string]string{"Message-Type": CombinerMessageType, "X-Request-Id": "[ignore]", "Origin-System-Id": CombinerOrigin, "Content-Type": ContentType, SchemaVersionHeader: CombinedSchemaVersion},
+		Body:    `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","title":"simple title","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing","http://base-url/concept/Concept","http://base-url/organisation/Organisation","http://base-url/company/Company","http://base-url/company/PublicCompany"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
 	}
 	dummyMsgProducer := DummyMsgProducer{t: t, expUUID: testUUID, expMsg: expMsg}
 	p := &RequestProcessor{DataCombiner: combiner, Forwarder: NewForwarder(dummyMsgProducer, allowedContentTypes)}
@@ -191,7 +191,7 @@ func TestForceMessage_FilteringError(t *testing.T) {
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
 
-	err := p.ForceMessagePublish(testUUID, "")
+	err := p.ForceMessagePublish(testUUID, "", "")
 	assert.Equal(t, InvalidContentTypeError, err)
 
 	assert.Equal(t, "info", hook.LastEntry().Level.String())
@@ -232,7 +232,7 @@ func TestForceMessageProducerError(t *testing.T) {
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
 
-	err := p.ForceMessagePublish(testUUID, "")
+	err := p.ForceMessagePublish(testUUID, "", "")
 	assert.Equal(t, dummyMsgProducer.expError, err)
 
 	assert.Equal(t, "error", hook.LastEntry().Level.String())
@@ -240,3 +240,37 @@ func TestForceMessageProducerError(t *testing.T) {
 	assert.Equal(t, hook.LastEntry().Data["error"].(error).Error(), "some error")
 	assert.Equal(t, 2, len(hook.Entries))
 }
+
+func TestForceMessageStaleContent(t *testing.T) {
+	testUUID := "some_uuid"
+	combiner := DummyDataCombiner{
+		t:            t,
+		expectedUUID: testUUID,
+		data:         CombinedModel{UUID: testUUID, LastModified: "2017-03-30T13:09:01Z", Content: ContentModel{"uuid": testUUID, "type": "Article"}},
+	}
+	producer := &RecordingMsgProducer{}
+	p := &RequestProcessor{DataCombiner: combiner, Forwarder: NewForwarder(producer, []string{"Article"}), StalePolicy: StalePolicy{Action: StaleActionRetry}}
+	advanceWatermark(p.Forwarder.Watermarks, testUUID, "2017-03-30T13:09:06.48Z")
+
+	err := p.ForceMessagePublish(testUUID, "some-tid", "")
+	assert.Equal(t, StaleReadError, err)
+	assert.Empty(t, producer.msgs)
+}
+
+func TestForceMessageWithCaller(t *testing.T) {
+	testUUID := "some_uuid"
+	combiner := DummyDataCombiner{
+		t:            t,
+		expectedUUID: testUUID,
+		data:         CombinedModel{UUID: testUUID, Content: ContentModel{"uuid": testUUID, "type": "Article"}},
+	}
+	producer := &RecordingMsgProducer{}
+	history, err := NewHistory(10, "")
+	assert.NoError(t, err)
+	p := &RequestProcessor{DataCombiner: combiner, Forwarder: NewForwarder(producer, []string{"Article"}), History: history}
+
+	assert.NoError(t, p.ForceMessagePublish(testUUID, "some-tid", "reindexer"))
+	assert.Len(t, producer.msgs, 1)
+	assert.Equal(t, "reindexer", producer.msgs[0].Headers[ForcedByHeader])
+	assert.Equal(t, "reindexer", history.ForUUID(testUUID)[0].Caller)
+}
@@ -0,0 +1,305 @@
+package processor
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+	uuidlib "github.com/satori/go.uuid"
+)
+
+const (
+	RetryAttemptHeader  = "X-Retry-Attempt"
+	DefaultRetryWorkers = 4
+	retryFileExtension  = ".retry"
+)
+
+// ParseRetryStages parses the comma separated delays of the retry stages, e.g. "10s,1m,10m".
+func ParseRetryStages(stages string) ([]time.Duration, error) {
+	var delays []time.Duration
+	for _, s := range strings.Split(stages, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid retry stage %q, expected a positive duration like 10s or 1m", s)
+		}
+		delays = append(delays, d)
+	}
+	if len(delays) == 0 {
+		return nil, fmt.Errorf("no retry stages in %q", stages)
+	}
+	return delays, nil
+}
+
+// RetryQueue hands the messages that failed with a transient error back to the processor later, after the delay of each retry stage.
+// Messages still failing after the last stage are dead-lettered.
+// Retries are waiting on a local timer, so the consumers go on with the next messages in the meantime.
+// Pending retries are kept in dir, so that they survive restarts: the consumers commit the messages once scheduled.
+type RetryQueue struct {
+	sync.Mutex
+	Stages []time.Duration
+	// Backoff is the wait before trying again to schedule the next retry of a message, when it couldn't be scheduled
+	Backoff time.Duration
+	// Workers is the number of retries handed back to the processor at the same time
+	Workers    int
+	dest       chan<- *KafkaQMessage
+	deadLetter DeadLetterQueue
+	dir        string
+	pending    retryHeap
+	wake       chan struct{}
+	stop       chan struct{}
+	stopped    bool
+	running    sync.WaitGroup
+	now        func() time.Time
+}
+
+type retryEntry struct {
+	ID      string           `json:"id"`
+	Topic   string           `json:"topic"`
+	Message consumer.Message `json:"message"`
+	// Stage is the index of the stage the retry is waiting for
+	Stage  int       `json:"stage"`
+	Due    time.Time `json:"due"`
+	Reason string    `json:"reason"`
+}
+
+func NewRetryQueue(stages []time.Duration, dest chan<- *KafkaQMessage, deadLetter DeadLetterQueue, dir string) (*RetryQueue, error) {
+	if dir == "" {
+		return nil, errors.New("the retry queue needs a directory to keep the pending retries, they would be lost on restarts otherwise")
+	}
+	q := &RetryQueue{
+		Stages:     stages,
+		Backoff:    DefaultRedeliveryBackoff,
+		Workers:    DefaultRetryWorkers,
+		dest:       dest,
+		deadLetter: deadLetter,
+		dir:        dir,
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		now:        time.Now,
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create retries directory %v: %v", dir, err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+retryFileExtension))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var e retryEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, fmt.Errorf("could not read pending retry %v: %v", f, err)
+		}
+		heap.Push(&q.pending, &e)
+	}
+	return q, nil
+}
+
+// Schedule parks the message until the delay of the stage has passed, or dead-letters it when there are no stages left.
+// Once it returns without error, the message doesn't need to be kept by the consumer anymore.
+func (q *RetryQueue) Schedule(topic string, m consumer.Message, stage int, reason error) error {
+	if stage >= len(q.Stages) {
+		return q.deadLetter.Send(topic, m, reason)
+	}
+
+	id, err := uuidlib.NewV4()
+	if err != nil {
+		return err
+	}
+	e := &retryEntry{ID: id.String(), Topic: topic, Message: m, Stage: stage, Due: q.now().Add(q.Stages[stage])}
+	if reason != nil {
+		e.Reason = reason.Error()
+	}
+	if err := q.persist(e); err != nil {
+		return err
+	}
+
+	q.Lock()
+	heap.Push(&q.pending, e)
+	q.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	tid := m.Headers["X-Request-Id"]
+	logger.WithTransactionID(tid).WithError(reason).Warnf("%v - Message from %v scheduled for retry %d of %d in %v.", tid, topic, stage+1, len(q.Stages), q.Stages[stage])
+	return nil
+}
+
+func (q *RetryQueue) Pending() int {
+	q.Lock()
+	defer q.Unlock()
+	return q.pending.Len()
+}
+
+// Start hands the due messages back to the processor, until Stop is called.
+// The due messages left when stopping stay in the retries directory, and are retried after a restart.
+func (q *RetryQueue) Start() {
+	n := q.Workers
+	if n < 1 {
+		n = 1
+	}
+	workers := make(chan struct{}, n)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		for _, e := range q.popDue() {
+			if !q.startRetry(workers, e) {
+				return
+			}
+		}
+
+		wait := time.Hour
+		q.Lock()
+		if q.pending.Len() > 0 {
+			wait = q.pending[0].Due.Sub(q.now())
+		}
+		q.Unlock()
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop stops handing messages back to the processor, and waits for the retries in progress to give up.
+func (q *RetryQueue) Stop() {
+	q.Lock()
+	q.stopped = true
+	q.Unlock()
+	close(q.stop)
+	q.running.Wait()
+}
+
+// startRetry retries the message once a worker is free, and reports false if the queue is stopped first.
+func (q *RetryQueue) startRetry(workers chan struct{}, e *retryEntry) bool {
+	select {
+	case workers <- struct{}{}:
+	case <-q.stop:
+		return false
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	if q.stopped {
+		<-workers
+		return false
+	}
+	q.running.Add(1)
+	go func() {
+		defer q.running.Done()
+		defer func() { <-workers }()
+		q.retry(e)
+	}()
+	return true
+}
+
+func (q *RetryQueue) popDue() []*retryEntry {
+	q.Lock()
+	defer q.Unlock()
+	var due []*retryEntry
+	now := q.now()
+	for q.pending.Len() > 0 && !q.pending[0].Due.After(now) {
+		due = append(due, heap.Pop(&q.pending).(*retryEntry))
+	}
+	return due
+}
+
+// retry processes the message again, and schedules the next stage when it fails again with a transient error.
+// When the queue is stopped in the meantime, the message is left in the retries directory.
+func (q *RetryQueue) retry(e *retryEntry) {
+	m := e.Message
+	headers := make(map[string]string, len(m.Headers)+1)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[RetryAttemptHeader] = fmt.Sprint(e.Stage + 1)
+	m.Headers = headers
+
+	km := newKafkaQMessage(e.Topic, m)
+	select {
+	case q.dest <- km:
+	case <-q.stop:
+		return
+	}
+	var err error
+	select {
+	case err = <-km.done:
+	case <-q.stop:
+		return
+	}
+
+	next := e.Stage + 1
+	if IsPermanentError(err) {
+		next = len(q.Stages)
+	}
+	if err != nil {
+		for {
+			scheduleErr := q.Schedule(e.Topic, e.Message, next, err)
+			if scheduleErr == nil {
+				break
+			}
+			logger.WithTransactionID(m.Headers["X-Request-Id"]).WithError(scheduleErr).Errorf("Could not schedule the next retry of message from %v, retrying in %v.", e.Topic, q.Backoff)
+			select {
+			case <-time.After(q.Backoff):
+			case <-q.stop:
+				return
+			}
+		}
+	}
+	q.forget(e)
+}
+
+func (q *RetryQueue) persist(e *retryEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(filepath.Join(q.dir, e.ID+retryFileExtension), b)
+}
+
+func (q *RetryQueue) forget(e *retryEntry) {
+	if err := os.Remove(filepath.Join(q.dir, e.ID+retryFileExtension)); err != nil && !os.IsNotExist(err) {
+		logger.WithError(err).Errorf("Could not remove the pending retry %v", e.ID)
+	}
+}
+
+// retryHeap orders the pending retries by due time.
+type retryHeap []*retryEntry
+
+func (h retryHeap) Len() int            { return len(h) }
+func (h retryHeap) Less(i, j int) bool  { return h[i].Due.Before(h[j].Due) }
+func (h retryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *retryHeap) Push(x interface{}) { *h = append(*h, x.(*retryEntry)) }
+func (h *retryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/message-queue-gonsumer/consumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryStages(t *testing.T) {
+	stages, err := ParseRetryStages("10s, 1m,10m")
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{10 * time.Second, time.Minute, 10 * time.Minute}, stages)
+
+	for _, s := range []string{"", ",", "10s,abc", "10s,-1m", "0s"} {
+		_, err := ParseRetryStages(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func newTestRetryQueue(t *testing.T, stages []time.Duration, ch chan<- *KafkaQMessage, deadLetter DeadLetterQueue) (*RetryQueue, func()) {
+	dir, err := ioutil.TempDir("", "retries")
+	assert.NoError(t, err)
+	q, err := NewRetryQueue(stages, ch, deadLetter, dir)
+	assert.NoError(t, err)
+	return q, func() { os.RemoveAll(dir) }
+}
+
+func TestNewRetryQueue_RequiresDirectory(t *testing.T) {
+	_, err := NewRetryQueue([]time.Duration{time.Minute}, make(chan *KafkaQMessage), NewDeadLetterQueue(&DummyDeadLetterProducer{}), "")
+	assert.Error(t, err, "scheduled retries would be lost on restarts")
+}
+
+func TestRetryQueue_RetriesUntilSuccess(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	q, cleanup := newTestRetryQueue(t, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}, ch, NewDeadLetterQueue(dlq))
+	defer cleanup()
+	go q.Start()
+	defer q.Stop()
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+
+	km := receiveRetry(t, ch)
+	assert.Equal(t, "someType", km.msgType)
+	assert.Equal(t, "1", km.msg.Headers[RetryAttemptHeader])
+	km.ack(errors.New("some error"))
+
+	km = receiveRetry(t, ch)
+	assert.Equal(t, "2", km.msg.Headers[RetryAttemptHeader])
+	assert.Equal(t, "body", km.msg.Body)
+	km.ack(nil)
+
+	assert.Eventually(t, func() bool { return q.Pending() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, dlq.msgs)
+}
+
+func TestRetryQueue_DeadLettersAfterLastStage(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	q, cleanup := newTestRetryQueue(t, []time.Duration{10 * time.Millisecond}, ch, NewDeadLetterQueue(dlq))
+	defer cleanup()
+	go q.Start()
+	defer q.Stop()
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+	receiveRetry(t, ch).ack(errors.New("still failing"))
+
+	assert.Eventually(t, func() bool {
+		dlq.Lock()
+		defer dlq.Unlock()
+		return len(dlq.msgs) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "body", dlq.msgs[0].Body)
+	assert.Equal(t, "still failing", dlq.msgs[0].Headers[DeadLetterReasonHeader])
+	assert.Empty(t, dlq.msgs[0].Headers[RetryAttemptHeader])
+	assert.Equal(t, 0, q.Pending())
+}
+
+func TestRetryQueue_DeadLettersPermanentErrorsImmediately(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	q, cleanup := newTestRetryQueue(t, []time.Duration{10 * time.Millisecond, time.Hour}, ch, NewDeadLetterQueue(dlq))
+	defer cleanup()
+	go q.Start()
+	defer q.Stop()
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+	receiveRetry(t, ch).ack(newPermanentError(errors.New("invalid body")))
+
+	assert.Eventually(t, func() bool {
+		dlq.Lock()
+		defer dlq.Unlock()
+		return len(dlq.msgs) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 0, q.Pending())
+}
+
+func TestRetryQueue_ReloadsPendingRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retries")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ch := make(chan *KafkaQMessage)
+	q, err := NewRetryQueue([]time.Duration{10 * time.Millisecond}, ch, NewDeadLetterQueue(&DummyDeadLetterProducer{}), dir)
+	assert.NoError(t, err)
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+retryFileExtension))
+	assert.Len(t, files, 1)
+
+	restarted, err := NewRetryQueue([]time.Duration{10 * time.Millisecond}, ch, NewDeadLetterQueue(&DummyDeadLetterProducer{}), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, restarted.Pending())
+	go restarted.Start()
+	defer restarted.Stop()
+
+	km := receiveRetry(t, ch)
+	assert.Equal(t, "body", km.msg.Body)
+	km.ack(nil)
+
+	assert.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "*"+retryFileExtension))
+		return len(files) == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestRetryQueue_BacksOffWhenTheNextRetryCantBeScheduled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retries")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ch := make(chan *KafkaQMessage)
+	q, err := NewRetryQueue([]time.Duration{10 * time.Millisecond, time.Hour}, ch, NewDeadLetterQueue(&DummyDeadLetterProducer{}), dir)
+	assert.NoError(t, err)
+	q.Backoff = 10 * time.Millisecond
+	go q.Start()
+	defer q.Stop()
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+	km := receiveRetry(t, ch)
+
+	// the next retry can't be persisted while the directory is missing
+	assert.NoError(t, os.RemoveAll(dir))
+	km.ack(errors.New("some error"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, q.Pending())
+
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	assert.Eventually(t, func() bool { return q.Pending() == 1 }, time.Second, 5*time.Millisecond, "the next retry should be scheduled after the backoff, not the last stage delay")
+}
+
+func TestRetryQueue_BoundsTheRetriesInProgress(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	q, cleanup := newTestRetryQueue(t, []time.Duration{10 * time.Millisecond}, ch, NewDeadLetterQueue(&DummyDeadLetterProducer{}))
+	defer cleanup()
+	q.Workers = 1
+	go q.Start()
+	defer q.Stop()
+
+	for _, tid := range []string{"some-tid1", "some-tid2"} {
+		m := consumer.Message{Headers: map[string]string{"X-Request-Id": tid}, Body: "body"}
+		assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+	}
+
+	km := receiveRetry(t, ch)
+	select {
+	case <-ch:
+		t.Fatal("the second retry should wait for the first one to be processed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	km.ack(nil)
+	receiveRetry(t, ch).ack(nil)
+}
+
+func TestRetryQueue_StopWaitsForTheRetriesInProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retries")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// nobody receives the retries, as when the processor has already stopped
+	ch := make(chan *KafkaQMessage)
+	q, err := NewRetryQueue([]time.Duration{10 * time.Millisecond}, ch, NewDeadLetterQueue(&DummyDeadLetterProducer{}), dir)
+	assert.NoError(t, err)
+	go q.Start()
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+	time.Sleep(50 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop should return once the retries in progress gave up")
+	}
+	select {
+	case <-ch:
+		t.Fatal("no retry should be handed to the processor once stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+retryFileExtension))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "the retry should be kept for after a restart")
+}
+
+func TestRetryQueue_StopEndsTheBackoff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retries")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ch := make(chan *KafkaQMessage)
+	q, err := NewRetryQueue([]time.Duration{10 * time.Millisecond, time.Hour}, ch, NewDeadLetterQueue(&DummyDeadLetterProducer{}), dir)
+	assert.NoError(t, err)
+	q.Backoff = 20 * time.Millisecond
+	go q.Start()
+
+	m := consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"}
+	assert.NoError(t, q.Schedule("someType", m, 0, errors.New("some error")))
+	km := receiveRetry(t, ch)
+
+	// the next retry can't be persisted while the directory is missing
+	assert.NoError(t, os.RemoveAll(dir))
+	km.ack(errors.New("some error"))
+	time.Sleep(50 * time.Millisecond)
+	q.Stop()
+
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, q.Pending(), "the next retry shouldn't be scheduled once stopped")
+}
+
+func TestRetryQueue_RetryAttemptIsNotForwarded(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+
+	headers := map[string]string{"X-Request-Id": "some-tid1", RetryAttemptHeader: "1"}
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	assert.NoError(t, f.filterAndForwardMsg(headers, &model, "some-tid1"))
+
+	assert.Len(t, producer.msgs, 1)
+	assert.NotContains(t, producer.msgs[0].Headers, RetryAttemptHeader)
+	assert.Equal(t, "1", headers[RetryAttemptHeader], "the retried message should keep its attempt")
+}
+
+func TestQConsumerProcessMsg_HandsTransientFailuresToRetries(t *testing.T) {
+	ch := make(chan *KafkaQMessage)
+	dlq := &DummyDeadLetterProducer{}
+	q, cleanup := newTestRetryQueue(t, []time.Duration{time.Hour}, ch, NewDeadLetterQueue(dlq))
+	defer cleanup()
+	kqc := KafkaQConsumer{Consumer: DummyConsumer{}, dest: ch, msgType: "someType", policy: NewDeliveryPolicy(3, 0), deadLetter: NewDeadLetterQueue(dlq), Retries: q}
+
+	attempts := 0
+	go func() {
+		for km := range ch {
+			attempts++
+			km.ack(errors.New("some error"))
+		}
+	}()
+
+	kqc.ProcessMsg(consumer.Message{Headers: map[string]string{"X-Request-Id": "some-tid1"}, Body: "body"})
+	close(ch)
+
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 1, q.Pending())
+	assert.Empty(t, dlq.msgs)
+}
+
+func receiveRetry(t *testing.T, ch <-chan *KafkaQMessage) *KafkaQMessage {
+	select {
+	case km := <-ch:
+		return km
+	case <-time.After(time.Second):
+		t.Fatal("the message wasn't retried")
+		return nil
+	}
+}
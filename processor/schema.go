@@ -0,0 +1,50 @@
+package processor
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	CombinedSchemaVersion = "2"
+	SchemaVersionHeader   = "Schema-Version"
+)
+
+var SchemaValidationError = errors.New("combined message doesn't match the schema")
+
+// CombinedSchema is the JSON Schema contract of the forwarded messages, for the current schema version.
+//
+//go:embed schema/combined-message-v2.json
+var CombinedSchema string
+
+var combinedSchema = mustLoadSchema(CombinedSchema)
+
+func mustLoadSchema(schema string) *gojsonschema.Schema {
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema))
+	if err != nil {
+		panic(fmt.Sprintf("invalid combined message schema: %v", err))
+	}
+	return s
+}
+
+// validateCombinedMessage checks the serialised message against the schema.
+// The returned error is permanent, as the same message would fail validation again.
+func validateCombinedMessage(b []byte) error {
+	result, err := combinedSchema.Validate(gojsonschema.NewBytesLoader(b))
+	if err != nil {
+		return newPermanentError(fmt.Errorf("%w: %v", SchemaValidationError, err))
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	var details []string
+	for _, e := range result.Errors() {
+		details = append(details, e.String())
+	}
+	return newPermanentError(fmt.Errorf("%w: %v", SchemaValidationError, strings.Join(details, "; ")))
+}
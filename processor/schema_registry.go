@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultSchemaSubject = "combined-message"
+	schemaFileExtension  = ".avsc"
+)
+
+// SchemaRegistry resolves the schemas binary payloads are tagged with.
+type SchemaRegistry interface {
+	// Latest returns the id and the schema of the newest version registered for the subject.
+	Latest(subject string) (int, string, error)
+	Schema(id int) (string, error)
+}
+
+type fileSchemaRegistry struct {
+	schemas  map[int]string
+	subjects map[string]int
+}
+
+// NewFileSchemaRegistry stands in for a schema registry service, so that schemas can be resolved offline.
+// Schemas are read from the files in dir named <subject>.<id>.avsc, with ids unique across subjects.
+func NewFileSchemaRegistry(dir string) (SchemaRegistry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+schemaFileExtension))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &fileSchemaRegistry{schemas: make(map[int]string), subjects: make(map[string]int)}
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), schemaFileExtension)
+		sep := strings.LastIndex(name, ".")
+		if sep <= 0 {
+			return nil, fmt.Errorf("schema file %v isn't named <subject>.<id>%v", f, schemaFileExtension)
+		}
+		subject := name[:sep]
+		id, err := strconv.Atoi(name[sep+1:])
+		if err != nil {
+			return nil, fmt.Errorf("schema file %v isn't named <subject>.<id>%v", f, schemaFileExtension)
+		}
+		if _, ok := r.schemas[id]; ok {
+			return nil, fmt.Errorf("schema id %d is registered more than once", id)
+		}
+
+		schema, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		r.schemas[id] = string(schema)
+		if latest, ok := r.subjects[subject]; !ok || id > latest {
+			r.subjects[subject] = id
+		}
+	}
+	return r, nil
+}
+
+func (r *fileSchemaRegistry) Latest(subject string) (int, string, error) {
+	id, ok := r.subjects[subject]
+	if !ok {
+		return 0, "", fmt.Errorf("no schema registered for subject %v", subject)
+	}
+	return id, r.schemas[id], nil
+}
+
+func (r *fileSchemaRegistry) Schema(id int) (string, error) {
+	schema, ok := r.schemas[id]
+	if !ok {
+		return "", fmt.Errorf("no schema registered with id %d", id)
+	}
+	return schema, nil
+}
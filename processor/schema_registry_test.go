@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSchemaRegistry_ShippedSchemas(t *testing.T) {
+	r, err := NewFileSchemaRegistry("schema/avro")
+	assert.NoError(t, err)
+
+	id, schema, err := r.Latest(DefaultSchemaSubject)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, id)
+
+	byID, err := r.Schema(id)
+	assert.NoError(t, err)
+	assert.Equal(t, schema, byID)
+}
+
+func TestFileSchemaRegistry_LatestVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemas")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "subject.1.avsc"), []byte(`"string"`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "subject.3.avsc"), []byte(`"long"`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.2.avsc"), []byte(`"int"`), 0644))
+
+	r, err := NewFileSchemaRegistry(dir)
+	assert.NoError(t, err)
+
+	id, schema, err := r.Latest("subject")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, id)
+	assert.Equal(t, `"long"`, schema)
+
+	schema, err = r.Schema(1)
+	assert.NoError(t, err)
+	assert.Equal(t, `"string"`, schema)
+
+	_, _, err = r.Latest("unknown")
+	assert.Error(t, err)
+	_, err = r.Schema(4)
+	assert.Error(t, err)
+}
+
+func TestFileSchemaRegistry_InvalidFiles(t *testing.T) {
+	tests := map[string][]string{
+		"Missing id":   {"subject.avsc"},
+		"Invalid id":   {"subject.v1.avsc"},
+		"Duplicate id": {"subject.1.avsc", "other.1.avsc"},
+	}
+
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "schemas")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			for _, f := range files {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, f), []byte(`"string"`), 0644))
+			}
+			_, err = NewFileSchemaRegistry(dir)
+			assert.Error(t, err)
+		})
+	}
+}
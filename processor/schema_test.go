@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestValidateCombinedMessage(t *testing.T) {
+	tests := map[string]struct {
+		body     string
+		expValid bool
+	}{
+		"Content publish": {
+			body:     `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"http://wordpress-article-mapper/content/some_uuid","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"false","content":{"uuid":"some_uuid","type":"Article"},"metadata":[{"thing":{"id":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995","prefLabel":"Barclays","types":["http://base-url/core/Thing"],"predicate":"http://base-url/about","apiUrl":"http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}]}`,
+			expValid: true,
+		},
+		"Delete": {
+			body:     `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"http://wordpress-article-mapper/content/some_uuid","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"true","content":null,"metadata":null}`,
+			expValid: true,
+		},
+		"Delete with the last known content": {
+			body:     `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"http://wordpress-article-mapper/content/some_uuid","lastModified":"2017-03-30T13:09:06.48Z","markedDeleted":"true","lastKnownType":"Article","lastKnownIdentifiers":[{"authority":"http://api.ft.com/system/FTCOM-METHODE","identifierValue":"some_uuid"}],"content":null,"metadata":null}`,
+			expValid: true,
+		},
+		"Annotations update for missing content": {
+			body:     `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":null,"metadata":[],"stale":true}`,
+			expValid: true,
+		},
+		"Annotations removed": {
+			body:     `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","type":"Article"},"metadata":[],"metadataStatus":"empty"}`,
+			expValid: true,
+		},
+		"Invalid metadataStatus": {
+			body: `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":null,"metadata":null,"metadataStatus":"gone"}`,
+		},
+		"Missing uuid": {
+			body: `{"schemaVersion":"2","uuid":"","contentUri":"","lastModified":"","markedDeleted":"","content":null,"metadata":null}`,
+		},
+		"Unknown schema version": {
+			body: `{"schemaVersion":"1","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":null,"metadata":null}`,
+		},
+		"Invalid markedDeleted": {
+			body: `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"yes","content":null,"metadata":null}`,
+		},
+		"Valid lastModified with a numeric zone offset": {
+			expValid: true,
+			body:     `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"2017-03-30T13:09:06.480+0000","markedDeleted":"false","content":{"uuid":"some_uuid","type":"Article"},"metadata":[]}`,
+		},
+		"Valid lastModified without a zone": {
+			expValid: true,
+			body:     `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"2017-03-30T13:09:06.480","markedDeleted":"false","content":{"uuid":"some_uuid","type":"Article"},"metadata":[]}`,
+		},
+		"Invalid lastModified": {
+			body: `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"yesterday","markedDeleted":"","content":null,"metadata":null}`,
+		},
+		"Missing metadata": {
+			body: `{"schemaVersion":"2","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":null}`,
+		},
+		"Not a json": {
+			body: `body`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateCombinedMessage([]byte(test.body))
+			if test.expValid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.True(t, errors.Is(err, SchemaValidationError))
+			assert.True(t, IsPermanentError(err), "invalid messages should be dead-lettered, not redelivered")
+		})
+	}
+}
+
+func TestForwardMsg_RejectsInvalidMessages(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+
+	headers := map[string]string{"X-Request-Id": "some-tid1"}
+	err := f.forwardMsg(headers, &CombinedModel{UUID: "", MarkedDeleted: "false"})
+	assert.True(t, errors.Is(err, SchemaValidationError))
+	assert.Empty(t, producer.msgs)
+}
+
+func TestForwardMsg_SetsSchemaVersion(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+
+	headers := map[string]string{"X-Request-Id": "some-tid1"}
+	err := f.forwardMsg(headers, &CombinedModel{UUID: "some_uuid", MarkedDeleted: "false"})
+	assert.NoError(t, err)
+
+	assert.Len(t, producer.msgs, 1)
+	assert.Equal(t, CombinedSchemaVersion, producer.msgs[0].Headers[SchemaVersionHeader])
+	var forwarded map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(producer.msgs[0].Body), &forwarded))
+	assert.Equal(t, CombinedSchemaVersion, forwarded["schemaVersion"])
+}
+
+func TestArchivedSchemaVersion1(t *testing.T) {
+	b, err := ioutil.ReadFile("schema/combined-message-v1.json")
+	assert.NoError(t, err)
+	v1 := mustLoadSchema(string(b))
+
+	// the messages forwarded before version 2 had no metadataStatus
+	result, err := v1.Validate(gojsonschema.NewStringLoader(`{"schemaVersion":"1","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":{"uuid":"some_uuid","type":"Article"},"metadata":[]}`))
+	assert.NoError(t, err)
+	assert.True(t, result.Valid(), "%v", result.Errors())
+
+	assert.Error(t, validateCombinedMessage([]byte(`{"schemaVersion":"1","uuid":"some_uuid","contentUri":"","lastModified":"","markedDeleted":"","content":null,"metadata":null}`)), "version 1 messages should no longer be forwarded")
+}
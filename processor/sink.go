@@ -0,0 +1,267 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/Financial-Times/post-publication-combiner/v2/utils"
+)
+
+const (
+	SinkKafka  = "kafka"
+	SinkStdout = "stdout"
+	// file sinks are configured as file:<path>, and http sinks with their URL
+	SinkFilePrefix = "file:"
+
+	MessageKeyHeader = "X-Message-Key"
+
+	redacted = "REDACTED"
+
+	// maxPartialFanOuts bounds the messages a FanOutSink remembers as sent to some of its sinks only
+	maxPartialFanOuts = 10000
+)
+
+// Sink receives the combined messages, keyed by the content UUID.
+// It has the method set of producer.MessageProducer, so that the kafka-proxy producer is a Sink.
+type Sink interface {
+	SendMessage(key string, m producer.Message) error
+	ConnectivityCheck() (string, error)
+}
+
+// NewSink builds the sinks of the comma separated spec: kafka, stdout, file:<path> or an http(s) URL.
+// Messages are sent to every sink when there are several of them.
+func NewSink(spec string, kafka Sink, client utils.Client) (Sink, error) {
+	var sinks []Sink
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+			continue
+		case s == SinkKafka:
+			sinks = append(sinks, kafka)
+		case s == SinkStdout:
+			sinks = append(sinks, NewWriterSink(os.Stdout))
+		case strings.HasPrefix(s, SinkFilePrefix):
+			sink, err := NewFileSink(strings.TrimPrefix(s, SinkFilePrefix))
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://"):
+			sinks = append(sinks, NewHTTPSink(s, client))
+		default:
+			return nil, fmt.Errorf("unknown sink %q, expected kafka, stdout, file:<path> or an http(s) URL", s)
+		}
+	}
+	switch len(sinks) {
+	case 0:
+		return nil, fmt.Errorf("no sink in %q", spec)
+	case 1:
+		return sinks[0], nil
+	}
+	return NewFanOutSink(sinks...), nil
+}
+
+// ProducedMessage is a message written by a WriterSink.
+type ProducedMessage struct {
+	Key     string
+	Headers map[string]string
+	Body    string
+}
+
+// WriterSink writes the messages to w as JSON lines.
+// Bodies that are not valid UTF-8, e.g. avro encoded or compressed, don't survive the JSON encoding.
+type WriterSink struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewFileSink appends the messages to the file at path.
+func NewFileSink(path string) (*WriterSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file sink %v: %v", path, err)
+	}
+	return NewWriterSink(f), nil
+}
+
+func (s *WriterSink) SendMessage(key string, m producer.Message) error {
+	b, err := json.Marshal(ProducedMessage{Key: key, Headers: m.Headers, Body: m.Body})
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *WriterSink) ConnectivityCheck() (string, error) {
+	return "", nil
+}
+
+// HTTPSink posts the messages to a webhook, with the message headers as request headers, and the key in the X-Message-Key header.
+type HTTPSink struct {
+	URL    string
+	client utils.Client
+}
+
+func NewHTTPSink(url string, client utils.Client) *HTTPSink {
+	return &HTTPSink{URL: url, client: client}
+}
+
+// SendMessage fails permanently when the webhook rejects the message with a 4xx status, other than 408 and 429.
+func (s *HTTPSink) SendMessage(key string, m producer.Message) error {
+	_, err := s.post(key, m)
+	return err
+}
+
+// post returns the status of the response as well, 0 when there was none.
+// The errors have the URL redacted, as it may have credentials.
+func (s *HTTPSink) post(key string, m producer.Message) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewBufferString(m.Body))
+	if err != nil {
+		return 0, newPermanentError(fmt.Errorf("invalid URL %v", RedactURL(s.URL)))
+	}
+	for k, v := range m.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(MessageKeyHeader, key)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("could not post message to %v: %v", RedactURL(s.URL), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return resp.StatusCode, newPermanentError(fmt.Errorf("message rejected by %v with status %d", RedactURL(s.URL), resp.StatusCode))
+	}
+	return resp.StatusCode, fmt.Errorf("posting message to %v was not successful, status %d", RedactURL(s.URL), resp.StatusCode)
+}
+
+// ConnectivityCheck doesn't call the webhook, as webhooks only have to accept the messages posted.
+func (s *HTTPSink) ConnectivityCheck() (string, error) {
+	return "", nil
+}
+
+// RedactURL hides the credentials the URL may have, in its user info and its query values.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for k := range query {
+			query[k] = []string{redacted}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// FanOutSink sends the messages to all of its sinks. Sending fails when it failed for any of them, after it was tried for all.
+// The sinks a message was sent to are remembered when it failed for others, so that sending the same message again
+// only sends it to the sinks it failed for. Up to maxPartialFanOuts messages are remembered, the others are sent again to all the sinks.
+type FanOutSink struct {
+	sync.Mutex
+	Sinks []Sink
+	// sent has the sinks each partially sent message was sent to, by key and body hash
+	sent map[string][]bool
+}
+
+func NewFanOutSink(sinks ...Sink) *FanOutSink {
+	return &FanOutSink{Sinks: sinks, sent: map[string][]bool{}}
+}
+
+func (s *FanOutSink) SendMessage(key string, m producer.Message) error {
+	id := key + "/" + contentHash([]byte(m.Body))
+	sent := make([]bool, len(s.Sinks))
+	s.Lock()
+	copy(sent, s.sent[id])
+	s.Unlock()
+
+	var failed []string
+	permanent := true
+	for i, sink := range s.Sinks {
+		if sent[i] {
+			continue
+		}
+		// sinks may set headers, each one gets its own copy
+		headers := make(map[string]string, len(m.Headers))
+		for k, v := range m.Headers {
+			headers[k] = v
+		}
+		if err := sink.SendMessage(key, producer.Message{Headers: headers, Body: m.Body}); err != nil {
+			failed = append(failed, err.Error())
+			permanent = permanent && IsPermanentError(err)
+			continue
+		}
+		sent[i] = true
+	}
+
+	permanent = permanent && len(failed) > 0
+	s.remember(id, sent, len(failed) > 0 && !permanent)
+	if len(failed) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("sending to %d of %d sinks failed: %v", len(failed), len(s.Sinks), strings.Join(failed, "; "))
+	if permanent {
+		return newPermanentError(err)
+	}
+	return err
+}
+
+// remember keeps the sinks the message was sent to while it is going to be sent again, forgets them otherwise.
+func (s *FanOutSink) remember(id string, sent []bool, retried bool) {
+	s.Lock()
+	defer s.Unlock()
+	if !retried {
+		delete(s.sent, id)
+		return
+	}
+	if _, ok := s.sent[id]; !ok && len(s.sent) >= maxPartialFanOuts {
+		for evicted := range s.sent {
+			delete(s.sent, evicted)
+			break
+		}
+	}
+	s.sent[id] = sent
+}
+
+func (s *FanOutSink) ConnectivityCheck() (string, error) {
+	for _, sink := range s.Sinks {
+		if msg, err := sink.ConnectivityCheck(); err != nil {
+			return msg, err
+		}
+	}
+	return "", nil
+}
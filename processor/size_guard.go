@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	SizeActionDeadLetter = "dead-letter"
+	SizeActionReference  = "reference"
+)
+
+var MessageTooLargeError = errors.New("combined message exceeds the maximum message size")
+
+// SizePolicy decides what happens to the messages which are bigger than MaxBytes, once encoded and compressed.
+// A zero MaxBytes doesn't limit the message size.
+type SizePolicy struct {
+	MaxBytes int
+	Action   string
+}
+
+func NewSizePolicy(maxBytes int, action string) (SizePolicy, error) {
+	if maxBytes < 0 {
+		return SizePolicy{}, fmt.Errorf("maximum message size can't be negative, got %d", maxBytes)
+	}
+	if action != SizeActionDeadLetter && action != SizeActionReference {
+		return SizePolicy{}, fmt.Errorf("unknown oversize action %q, expected %q or %q", action, SizeActionDeadLetter, SizeActionReference)
+	}
+	return SizePolicy{MaxBytes: maxBytes, Action: action}, nil
+}
+
+func (p SizePolicy) exceeded(size int) bool {
+	return p.MaxBytes > 0 && size > p.MaxBytes
+}
+
+// checkSize returns whether the message should be sent as a reference, or the error dead-lettering it.
+func (p *Forwarder) checkSize(model *CombinedModel, size int) (bool, error) {
+	if !p.SizePolicy.exceeded(size) {
+		return false, nil
+	}
+	if p.SizePolicy.Action != SizeActionReference || p.Blobs == nil {
+		// the same message would be too big on redelivery
+		return false, newPermanentError(fmt.Errorf("%w: %d bytes for uuid=%v, the limit is %d bytes", MessageTooLargeError, size, model.UUID, p.SizePolicy.MaxBytes))
+	}
+	return true, nil
+}
@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSizePolicy(t *testing.T) {
+	_, err := NewSizePolicy(1024, SizeActionDeadLetter)
+	assert.NoError(t, err)
+	_, err = NewSizePolicy(0, SizeActionReference)
+	assert.NoError(t, err)
+	_, err = NewSizePolicy(-1, SizeActionDeadLetter)
+	assert.Error(t, err)
+	_, err = NewSizePolicy(1024, "truncate")
+	assert.Error(t, err)
+}
+
+func TestForwardMsg_OversizedMessageIsDeadLettered(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.SizePolicy = SizePolicy{MaxBytes: 100, Action: SizeActionDeadLetter}
+
+	headers := map[string]string{"X-Request-Id": "some-tid1"}
+	model := CombinedModel{UUID: "some_uuid", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article", "body": strings.Repeat("text ", 100)}}
+	err := f.forwardMsg(headers, &model)
+	assert.True(t, errors.Is(err, MessageTooLargeError))
+	assert.True(t, IsPermanentError(err), "oversized messages should be dead-lettered, not redelivered")
+	assert.Empty(t, producer.msgs)
+}
+
+func TestForwardMsg_SizeIsMeasuredAfterCompression(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.SizePolicy = SizePolicy{MaxBytes: 200, Action: SizeActionDeadLetter}
+	f.Compression = CompressionZstd
+
+	headers := map[string]string{"X-Request-Id": "some-tid1"}
+	model := CombinedModel{UUID: "some_uuid", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article", "body": strings.Repeat("text ", 100)}}
+	assert.NoError(t, f.forwardMsg(headers, &model))
+	assert.Len(t, producer.msgs, 1)
+}
+
+func TestForwardMsg_OversizedMessageIsSentAsReference(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	blobs, err := NewFileBlobStore(dir)
+	assert.NoError(t, err)
+
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.SizePolicy = SizePolicy{MaxBytes: 100, Action: SizeActionReference}
+	f.Blobs = blobs
+	f.Compression = CompressionGzip
+
+	headers := map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": CombinerOrigin}
+	model := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article", "body": strings.Repeat("text ", 1000)}}
+	assert.NoError(t, f.forwardMsg(headers, &model))
+
+	assert.Len(t, producer.msgs, 1)
+	assert.Equal(t, "some_uuid", producer.keys[0])
+	h := producer.msgs[0].Headers
+	assert.Equal(t, CombinerReferenceMessageType, h["Message-Type"])
+	assert.Equal(t, ContentType, h["Content-Type"])
+	assert.Equal(t, CombinerOrigin, h["Origin-System-Id"])
+	assert.NotContains(t, h, ContentEncodingHeader)
+
+	var ref ReferenceModel
+	assert.NoError(t, json.Unmarshal([]byte(producer.msgs[0].Body), &ref))
+	assert.Equal(t, "some_uuid", ref.UUID)
+	assert.Equal(t, "2017-03-30T13:09:06.48Z", ref.LastModified)
+	assert.Equal(t, "false", ref.MarkedDeleted)
+	assert.Equal(t, CompressionGzip, ref.ContentEncoding)
+	assert.Equal(t, ContentType, ref.ContentType)
+
+	stored, err := blobs.Get(ref.ClaimCheck)
+	assert.NoError(t, err)
+	assert.Len(t, stored, ref.Size)
+	body, err := Decompress(ref.ContentEncoding, stored)
+	assert.NoError(t, err)
+	var forwarded CombinedModel
+	assert.NoError(t, json.Unmarshal(body, &forwarded))
+	assert.Equal(t, model, forwarded)
+}
+
+func TestForwardMsg_ReferenceWithoutBlobStoreIsDeadLettered(t *testing.T) {
+	producer := &RecordingMsgProducer{}
+	f := NewForwarder(producer, []string{"Article"})
+	f.SizePolicy = SizePolicy{MaxBytes: 10, Action: SizeActionReference}
+
+	err := f.forwardMsg(map[string]string{}, &CombinedModel{UUID: "some_uuid", MarkedDeleted: "false"})
+	assert.True(t, errors.Is(err, MessageTooLargeError))
+	assert.Empty(t, producer.msgs)
+}
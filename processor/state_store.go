@@ -0,0 +1,345 @@
+package processor
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/rcrowley/go-metrics"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	StateStoreMemory = "memory"
+	StateStoreBolt   = "bolt"
+
+	DefaultStateCapacity = 1000000
+	DefaultStateTTL      = 30 * 24 * time.Hour
+
+	WatermarksNamespace = "watermarks"
+	HashesNamespace     = "hashes"
+)
+
+// StateStore keeps the per-UUID state of the combiner, grouped in namespaces.
+// Entries expire once they weren't written for longer than the TTL of the store.
+type StateStore interface {
+	Get(namespace string, uuid string) ([]byte, bool, error)
+	Put(namespace string, uuid string, value []byte) error
+	Delete(namespace string, uuid string) error
+	Close() error
+}
+
+// NewStateStore returns the store of the kind, which is either in memory or embedded on disk at path.
+func NewStateStore(kind string, path string, ttl time.Duration) (StateStore, error) {
+	switch kind {
+	case StateStoreMemory:
+		return NewInMemoryStateStore(DefaultStateCapacity, ttl), nil
+	case StateStoreBolt:
+		return NewBoltStateStore(path, ttl)
+	}
+	return nil, fmt.Errorf("unknown state store %q, expected %q or %q", kind, StateStoreMemory, StateStoreBolt)
+}
+
+type stateMetrics struct {
+	hits      metrics.Counter
+	misses    metrics.Counter
+	puts      metrics.Counter
+	evictions metrics.Counter
+	errors    metrics.Counter
+}
+
+func newStateMetrics(kind string) stateMetrics {
+	prefix := "combiner.state." + kind + "."
+	return stateMetrics{
+		hits:      metrics.GetOrRegisterCounter(prefix+"hits", metrics.DefaultRegistry),
+		misses:    metrics.GetOrRegisterCounter(prefix+"misses", metrics.DefaultRegistry),
+		puts:      metrics.GetOrRegisterCounter(prefix+"puts", metrics.DefaultRegistry),
+		evictions: metrics.GetOrRegisterCounter(prefix+"evictions", metrics.DefaultRegistry),
+		errors:    metrics.GetOrRegisterCounter(prefix+"errors", metrics.DefaultRegistry),
+	}
+}
+
+type inMemoryStateStore struct {
+	sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[stateKey]*list.Element
+	recency  *list.List
+	metrics  stateMetrics
+	now      func() time.Time
+}
+
+type stateKey struct {
+	namespace string
+	uuid      string
+}
+
+type stateEntry struct {
+	key     stateKey
+	value   []byte
+	expires time.Time
+}
+
+// NewInMemoryStateStore keeps up to capacity entries, evicting the least recently used ones first.
+// A zero ttl keeps the entries until they are evicted.
+func NewInMemoryStateStore(capacity int, ttl time.Duration) StateStore {
+	if capacity <= 0 {
+		capacity = DefaultStateCapacity
+	}
+	return &inMemoryStateStore{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[stateKey]*list.Element),
+		recency:  list.New(),
+		metrics:  newStateMetrics(StateStoreMemory),
+		now:      time.Now,
+	}
+}
+
+func (s *inMemoryStateStore) Get(namespace string, uuid string) ([]byte, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	el, ok := s.entries[stateKey{namespace, uuid}]
+	if !ok {
+		s.metrics.misses.Inc(1)
+		return nil, false, nil
+	}
+	entry := el.Value.(*stateEntry)
+	if expired(entry.expires, s.now()) {
+		s.remove(el)
+		s.metrics.evictions.Inc(1)
+		s.metrics.misses.Inc(1)
+		return nil, false, nil
+	}
+	s.recency.MoveToFront(el)
+	s.metrics.hits.Inc(1)
+	return entry.value, true, nil
+}
+
+func (s *inMemoryStateStore) Put(namespace string, uuid string, value []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	s.metrics.puts.Inc(1)
+	key := stateKey{namespace, uuid}
+	expires := expiry(s.ttl, s.now())
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*stateEntry)
+		entry.value = value
+		entry.expires = expires
+		s.recency.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[key] = s.recency.PushFront(&stateEntry{key: key, value: value, expires: expires})
+	for s.recency.Len() > s.capacity {
+		s.remove(s.recency.Back())
+		s.metrics.evictions.Inc(1)
+	}
+	return nil
+}
+
+func (s *inMemoryStateStore) Delete(namespace string, uuid string) error {
+	s.Lock()
+	defer s.Unlock()
+	if el, ok := s.entries[stateKey{namespace, uuid}]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+func (s *inMemoryStateStore) Close() error {
+	return nil
+}
+
+func (s *inMemoryStateStore) remove(el *list.Element) {
+	s.recency.Remove(el)
+	delete(s.entries, el.Value.(*stateEntry).key)
+}
+
+type boltStateStore struct {
+	db      *bolt.DB
+	ttl     time.Duration
+	metrics stateMetrics
+	now     func() time.Time
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewBoltStateStore keeps the state in a bbolt database at path, with a bucket per namespace.
+// Expired entries are ignored when read, and removed periodically.
+func NewBoltStateStore(path string, ttl time.Duration) (StateStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("could not create state directory for %v: %v", path, err)
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open state database %v: %v", path, err)
+	}
+
+	s := &boltStateStore{
+		db:      db,
+		ttl:     ttl,
+		metrics: newStateMetrics(StateStoreBolt),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+	if ttl > 0 {
+		s.stopped.Add(1)
+		go s.sweepPeriodically(sweepInterval(ttl))
+	}
+	return s, nil
+}
+
+func (s *boltStateStore) Get(namespace string, uuid string) ([]byte, bool, error) {
+	var value []byte
+	var expires time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(namespace))
+		if b == nil {
+			return nil
+		}
+		stored := b.Get([]byte(uuid))
+		if stored == nil {
+			return nil
+		}
+		var err error
+		// values are only valid during the transaction
+		expires, value, err = decodeStateValue(stored)
+		value = append([]byte(nil), value...)
+		return err
+	})
+	if err != nil {
+		s.metrics.errors.Inc(1)
+		return nil, false, err
+	}
+	if value == nil || expired(expires, s.now()) {
+		s.metrics.misses.Inc(1)
+		return nil, false, nil
+	}
+	s.metrics.hits.Inc(1)
+	return value, true, nil
+}
+
+func (s *boltStateStore) Put(namespace string, uuid string, value []byte) error {
+	s.metrics.puts.Inc(1)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(namespace))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(uuid), encodeStateValue(expiry(s.ttl, s.now()), value))
+	})
+	if err != nil {
+		s.metrics.errors.Inc(1)
+	}
+	return err
+}
+
+func (s *boltStateStore) Delete(namespace string, uuid string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(namespace))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(uuid))
+	})
+	if err != nil {
+		s.metrics.errors.Inc(1)
+	}
+	return err
+}
+
+func (s *boltStateStore) Close() error {
+	close(s.stop)
+	s.stopped.Wait()
+	return s.db.Close()
+}
+
+func (s *boltStateStore) sweepPeriodically(interval time.Duration) {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.sweep(); err != nil {
+				s.metrics.errors.Inc(1)
+				logger.WithError(err).Error("Could not remove expired state")
+			}
+		}
+	}
+}
+
+// sweep removes the expired entries of every namespace.
+func (s *boltStateStore) sweep() error {
+	now := s.now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			var keys [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				expires, _, err := decodeStateValue(v)
+				if err != nil || expired(expires, now) {
+					keys = append(keys, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			s.metrics.evictions.Inc(int64(len(keys)))
+			return nil
+		})
+	})
+}
+
+func sweepInterval(ttl time.Duration) time.Duration {
+	if interval := ttl / 10; interval < time.Hour {
+		return interval
+	}
+	return time.Hour
+}
+
+func expiry(ttl time.Duration, now time.Time) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+func expired(expires time.Time, now time.Time) bool {
+	return !expires.IsZero() && now.After(expires)
+}
+
+// stored values are prefixed with their expiry in unix nanoseconds, 0 for values that don't expire
+func encodeStateValue(expires time.Time, value []byte) []byte {
+	b := make([]byte, 8+len(value))
+	if !expires.IsZero() {
+		binary.BigEndian.PutUint64(b, uint64(expires.UnixNano()))
+	}
+	copy(b[8:], value)
+	return b
+}
+
+func decodeStateValue(b []byte) (time.Time, []byte, error) {
+	if len(b) < 8 {
+		return time.Time{}, nil, errors.New("invalid state value")
+	}
+	var expires time.Time
+	if nanos := binary.BigEndian.Uint64(b[:8]); nanos != 0 {
+		expires = time.Unix(0, int64(nanos))
+	}
+	return expires, b[8:], nil
+}
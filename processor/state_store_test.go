@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stores := map[string]func() StateStore{
+		StateStoreMemory: func() StateStore { return NewInMemoryStateStore(10, time.Hour) },
+		StateStoreBolt: func() StateStore {
+			s, err := NewBoltStateStore(filepath.Join(dir, "nested", "state.db"), time.Hour)
+			assert.NoError(t, err)
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore()
+			defer s.Close()
+
+			_, ok, err := s.Get(WatermarksNamespace, "uuid1")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.NoError(t, s.Put(WatermarksNamespace, "uuid1", []byte("value1")))
+			assert.NoError(t, s.Put(HashesNamespace, "uuid1", []byte("value2")))
+
+			value, ok, err := s.Get(WatermarksNamespace, "uuid1")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, []byte("value1"), value)
+			value, _, _ = s.Get(HashesNamespace, "uuid1")
+			assert.Equal(t, []byte("value2"), value, "namespaces should be kept apart")
+
+			assert.NoError(t, s.Delete(WatermarksNamespace, "uuid1"))
+			_, ok, err = s.Get(WatermarksNamespace, "uuid1")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			assert.NoError(t, s.Delete(WatermarksNamespace, "uuid2"))
+		})
+	}
+}
+
+func TestInMemoryStateStoreExpiry(t *testing.T) {
+	s := NewInMemoryStateStore(10, time.Hour).(*inMemoryStateStore)
+	now := time.Date(2017, 3, 30, 13, 9, 6, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	assert.NoError(t, s.Put(WatermarksNamespace, "uuid1", []byte("value1")))
+	now = now.Add(59 * time.Minute)
+	_, ok, _ := s.Get(WatermarksNamespace, "uuid1")
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok, _ = s.Get(WatermarksNamespace, "uuid1")
+	assert.False(t, ok, "the entry should have expired")
+	assert.Empty(t, s.entries)
+}
+
+func TestInMemoryStateStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	s := NewInMemoryStateStore(2, 0)
+
+	assert.NoError(t, s.Put(WatermarksNamespace, "uuid1", []byte("value1")))
+	assert.NoError(t, s.Put(WatermarksNamespace, "uuid2", []byte("value2")))
+	s.Get(WatermarksNamespace, "uuid1")
+	assert.NoError(t, s.Put(WatermarksNamespace, "uuid3", []byte("value3")))
+
+	_, ok, _ := s.Get(WatermarksNamespace, "uuid1")
+	assert.True(t, ok)
+	_, ok, _ = s.Get(WatermarksNamespace, "uuid2")
+	assert.False(t, ok, "uuid2 should have been evicted")
+}
+
+func TestBoltStateStoreExpiryAndRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.db")
+
+	store, err := NewBoltStateStore(path, time.Hour)
+	assert.NoError(t, err)
+	s := store.(*boltStateStore)
+	now := time.Date(2017, 3, 30, 13, 9, 6, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	assert.NoError(t, s.Put(WatermarksNamespace, "uuid1", []byte("value1")))
+	now = now.Add(30 * time.Minute)
+	assert.NoError(t, s.Put(WatermarksNamespace, "uuid2", []byte("value2")))
+
+	now = now.Add(31 * time.Minute)
+	_, ok, err := s.Get(WatermarksNamespace, "uuid1")
+	assert.NoError(t, err)
+	assert.False(t, ok, "the entry should have expired")
+
+	assert.NoError(t, s.sweep())
+	assert.NoError(t, s.Close())
+
+	store, err = NewBoltStateStore(path, 0)
+	assert.NoError(t, err)
+	defer store.Close()
+	restarted := store.(*boltStateStore)
+	restarted.now = func() time.Time { return now }
+
+	value, ok, err := restarted.Get(WatermarksNamespace, "uuid2")
+	assert.NoError(t, err)
+	assert.True(t, ok, "the state should survive restarts")
+	assert.Equal(t, []byte("value2"), value)
+	_, ok, err = restarted.Get(WatermarksNamespace, "uuid1")
+	assert.NoError(t, err)
+	assert.False(t, ok, "expired entries should have been removed")
+}
+
+func TestNewStateStore(t *testing.T) {
+	s, err := NewStateStore(StateStoreMemory, "", time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	_, err = NewStateStore("redis", "", time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+)
+
+const (
+	DefaultWatermarkCapacity = 100000
+
+	StaleActionRetry   = "retry"
+	StaleActionForward = "forward"
+
+	// DefaultMaxStaleRetryWait bounds the time spent waiting for fresh content, as the retries hold up the processing of both topics.
+	DefaultMaxStaleRetryWait = 5 * time.Second
+)
+
+var StaleReadError = errors.New("content is older than the last forwarded version") // used when retries didn't return fresh content
+
+// WatermarkStore records the highest lastModified forwarded per UUID.
+type WatermarkStore interface {
+	Get(uuid string) (time.Time, bool)
+	// Advance records lastModified, unless a newer one is already recorded for the UUID.
+	Advance(uuid string, lastModified time.Time)
+}
+
+// StalePolicy decides what happens when a combine returns content older than the watermark of its UUID,
+// which happens when content is read from a lagging document-store replica.
+// The zero value retries, with no retries: stale content is never forwarded unless the policy says so.
+type StalePolicy struct {
+	Action     string
+	MaxRetries int
+	RetryDelay time.Duration
+	// MaxWait bounds the total delay of the retries, DefaultMaxStaleRetryWait when zero.
+	MaxWait time.Duration
+}
+
+func NewStalePolicy(action string, maxRetries int, retryDelay time.Duration) (StalePolicy, error) {
+	if action != StaleActionRetry && action != StaleActionForward {
+		return StalePolicy{}, fmt.Errorf("unknown stale content action %q, expected %q or %q", action, StaleActionRetry, StaleActionForward)
+	}
+	return StalePolicy{Action: action, MaxRetries: maxRetries, RetryDelay: retryDelay}, nil
+}
+
+// combineWithStalePolicy calls combine until it returns content that isn't older than the watermark of its UUID, as far as the policy allows.
+// With the forward action, stale content is returned marked as such.
+// Retries stop once waiting for the next one would exceed the maximum wait, leaving it to the redelivery of the message.
+func combineWithStalePolicy(combine func() (CombinedModel, error), watermarks WatermarkStore, policy StalePolicy, tid string) (CombinedModel, error) {
+	maxWait := policy.MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultMaxStaleRetryWait
+	}
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		combinedMSG, err := combine()
+		if err != nil || watermarks == nil || !isOlderThanWatermark(watermarks, combinedMSG.UUID, combinedMSG.LastModified) {
+			return combinedMSG, err
+		}
+
+		if policy.Action == StaleActionForward {
+			logger.WithTransactionID(tid).WithUUID(combinedMSG.UUID).Warnf("%v - Content with lastModified: %v is older than the last forwarded one, it will be marked as stale.", tid, combinedMSG.LastModified)
+			combinedMSG.Stale = true
+			return combinedMSG, nil
+		}
+		if attempt >= policy.MaxRetries || waited+policy.RetryDelay > maxWait {
+			return combinedMSG, StaleReadError
+		}
+
+		logger.WithTransactionID(tid).WithUUID(combinedMSG.UUID).Warnf("%v - Content with lastModified: %v is older than the last forwarded one, retrying.", tid, combinedMSG.LastModified)
+		time.Sleep(policy.RetryDelay)
+		waited += policy.RetryDelay
+	}
+}
+
+type stateWatermarkStore struct {
+	sync.Mutex
+	state StateStore
+}
+
+// NewWatermarkStore keeps the watermarks in the state store, so that they survive restarts with a persistent store.
+func NewWatermarkStore(state StateStore) WatermarkStore {
+	return &stateWatermarkStore{state: state}
+}
+
+func (s *stateWatermarkStore) Get(uuid string) (time.Time, bool) {
+	value, ok, err := s.state.Get(WatermarksNamespace, uuid)
+	if err != nil {
+		logger.WithField("uuid", uuid).WithError(err).Error("Could not load watermark")
+		return time.Time{}, false
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(value))
+	if err != nil {
+		logger.WithField("uuid", uuid).WithError(err).Error("Could not parse watermark")
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (s *stateWatermarkStore) Advance(uuid string, lastModified time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	if current, ok := s.Get(uuid); ok && !lastModified.After(current) {
+		return
+	}
+	if err := s.state.Put(WatermarksNamespace, uuid, []byte(lastModified.Format(time.RFC3339Nano))); err != nil {
+		logger.WithField("uuid", uuid).WithError(err).Error("Could not persist watermark")
+	}
+}
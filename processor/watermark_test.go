@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatermarkStoreAdvance(t *testing.T) {
+	state := NewInMemoryStateStore(10, 0)
+	s := NewWatermarkStore(state)
+	older := time.Date(2017, 3, 30, 13, 9, 1, 0, time.UTC)
+	newer := time.Date(2017, 3, 30, 13, 9, 6, 480000000, time.UTC)
+
+	_, ok := s.Get("uuid1")
+	assert.False(t, ok)
+
+	s.Advance("uuid1", newer)
+	s.Advance("uuid1", older)
+
+	watermark, ok := s.Get("uuid1")
+	assert.True(t, ok)
+	assert.True(t, newer.Equal(watermark))
+
+	restarted := NewWatermarkStore(state)
+	watermark, ok = restarted.Get("uuid1")
+	assert.True(t, ok, "the watermarks should be read from the state store")
+	assert.True(t, newer.Equal(watermark))
+}
+
+func TestWatermarkStoreStateErrors(t *testing.T) {
+	s := NewWatermarkStore(&failingStateStore{})
+	s.Advance("uuid1", time.Date(2017, 3, 30, 13, 9, 6, 0, time.UTC))
+	_, ok := s.Get("uuid1")
+	assert.False(t, ok)
+}
+
+func TestNewStalePolicy(t *testing.T) {
+	p, err := NewStalePolicy(StaleActionRetry, 3, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, StalePolicy{Action: StaleActionRetry, MaxRetries: 3, RetryDelay: time.Second}, p)
+
+	_, err = NewStalePolicy("drop", 3, time.Second)
+	assert.Error(t, err)
+}
+
+func TestCombineWithStalePolicy(t *testing.T) {
+	stale := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:01Z"}
+	fresh := CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:06Z"}
+
+	tests := map[string]struct {
+		policy    StalePolicy
+		results   []CombinedModel
+		expModel  CombinedModel
+		expErr    error
+		expCombos int
+	}{
+		"Fresh content": {
+			policy:    StalePolicy{Action: StaleActionRetry, MaxRetries: 2},
+			results:   []CombinedModel{fresh},
+			expModel:  fresh,
+			expCombos: 1,
+		},
+		"Retry until fresh": {
+			policy:    StalePolicy{Action: StaleActionRetry, MaxRetries: 2},
+			results:   []CombinedModel{stale, stale, fresh},
+			expModel:  fresh,
+			expCombos: 3,
+		},
+		"Retries exhausted": {
+			policy:    StalePolicy{Action: StaleActionRetry, MaxRetries: 2},
+			results:   []CombinedModel{stale, stale, stale, fresh},
+			expModel:  stale,
+			expErr:    StaleReadError,
+			expCombos: 3,
+		},
+		"Zero value policy doesn't forward stale content": {
+			policy:    StalePolicy{},
+			results:   []CombinedModel{stale, fresh},
+			expModel:  stale,
+			expErr:    StaleReadError,
+			expCombos: 1,
+		},
+		"Retries bounded by the maximum wait": {
+			policy:    StalePolicy{Action: StaleActionRetry, MaxRetries: 10, RetryDelay: 10 * time.Millisecond, MaxWait: 25 * time.Millisecond},
+			results:   []CombinedModel{stale, stale, stale, fresh},
+			expModel:  stale,
+			expErr:    StaleReadError,
+			expCombos: 3,
+		},
+		"Forward marked as stale": {
+			policy:    StalePolicy{Action: StaleActionForward},
+			results:   []CombinedModel{stale},
+			expModel:  CombinedModel{UUID: "uuid1", LastModified: "2017-03-30T13:09:01Z", Stale: true},
+			expCombos: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			watermarks := NewWatermarkStore(NewInMemoryStateStore(10, 0))
+			advanceWatermark(watermarks, "uuid1", "2017-03-30T13:09:05Z")
+
+			combos := 0
+			m, err := combineWithStalePolicy(func() (CombinedModel, error) {
+				combos++
+				return test.results[combos-1], nil
+			}, watermarks, test.policy, "some-tid")
+
+			assert.Equal(t, test.expErr, err)
+			assert.Equal(t, test.expModel, m)
+			assert.Equal(t, test.expCombos, combos)
+		})
+	}
+}
+
+func TestCombineWithStalePolicy_CombinerError(t *testing.T) {
+	expErr := errors.New("some error")
+	_, err := combineWithStalePolicy(func() (CombinedModel, error) {
+		return CombinedModel{}, expErr
+	}, NewWatermarkStore(NewInMemoryStateStore(10, 0)), StalePolicy{Action: StaleActionRetry, MaxRetries: 2}, "some-tid")
+
+	assert.Equal(t, expErr, err)
+}
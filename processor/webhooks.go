@@ -0,0 +1,258 @@
+package processor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/Financial-Times/post-publication-combiner/v2/utils"
+)
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+
+	DefaultWebhookMaxAttempts = 5
+	DefaultWebhookBackoff     = time.Second
+	webhookQueueSize          = 1000
+)
+
+// Subscriber receives the combined messages of the content matching its filters, posted to its URL.
+// Deliveries are signed when it has a secret.
+type Subscriber struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// ContentTypes and Origins filter the messages delivered, all of them are delivered when empty
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	Origins      []string `json:"origins,omitempty"`
+	Secret       string   `json:"secret,omitempty"`
+}
+
+// LoadSubscribers reads the JSON array of the webhook subscribers at path.
+func LoadSubscribers(path string) ([]Subscriber, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read webhook subscribers: %v", err)
+	}
+	var subscribers []Subscriber
+	if err := json.Unmarshal(b, &subscribers); err != nil {
+		return nil, fmt.Errorf("could not parse webhook subscribers: %v", err)
+	}
+	names := map[string]bool{}
+	for _, s := range subscribers {
+		if s.Name == "" || names[s.Name] {
+			return nil, fmt.Errorf("webhook subscriber names must be set and unique, found %q", s.Name)
+		}
+		names[s.Name] = true
+		if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+			return nil, fmt.Errorf("invalid URL %q for webhook subscriber %v", s.URL, s.Name)
+		}
+	}
+	return subscribers, nil
+}
+
+// SubscriberStatus reports the deliveries to a subscriber since the start. The credentials in its URL are redacted.
+type SubscriberStatus struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Delivered int64  `json:"delivered"`
+	// Failed counts the messages still failing after the last attempt, and Dropped the ones not queued as the queue was full
+	Failed         int64      `json:"failed"`
+	Dropped        int64      `json:"dropped"`
+	Pending        int        `json:"pending"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastDelivery   *time.Time `json:"lastDelivery,omitempty"`
+	LastFailure    *time.Time `json:"lastFailure,omitempty"`
+}
+
+// Webhooks delivers the forwarded combined messages to the subscribers.
+// Every subscriber has its own queue, so that a slow or failing subscriber delays neither the forwarding nor the other subscribers.
+// The messages are posted like by the HTTP sinks, the client is expected to time out.
+type Webhooks struct {
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt, it doubles after every failed attempt
+	Backoff time.Duration
+	subs    []*subscription
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type subscription struct {
+	sync.Mutex
+	Subscriber
+	sink   *HTTPSink
+	queue  chan webhookDelivery
+	status SubscriberStatus
+}
+
+type webhookDelivery struct {
+	tid     string
+	uuid    string
+	headers map[string]string
+	body    []byte
+}
+
+func NewWebhooks(subscribers []Subscriber, client utils.Client) *Webhooks {
+	w := &Webhooks{
+		MaxAttempts: DefaultWebhookMaxAttempts,
+		Backoff:     DefaultWebhookBackoff,
+		stop:        make(chan struct{}),
+	}
+	for _, s := range subscribers {
+		w.subs = append(w.subs, &subscription{
+			Subscriber: s,
+			sink:       NewHTTPSink(s.URL, client),
+			queue:      make(chan webhookDelivery, webhookQueueSize),
+			status:     SubscriberStatus{Name: s.Name, URL: RedactURL(s.URL)},
+		})
+	}
+	return w
+}
+
+// Start delivers the queued messages, until Stop is called.
+func (w *Webhooks) Start() {
+	for _, s := range w.subs {
+		w.wg.Add(1)
+		go w.deliverAll(s)
+	}
+}
+
+func (w *Webhooks) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// Notify queues the combined message for the subscribers interested in it, without waiting for the deliveries.
+func (w *Webhooks) Notify(headers map[string]string, model *CombinedModel) {
+	tid := headers["X-Request-Id"]
+	body, err := json.Marshal(model)
+	if err != nil {
+		logger.WithTransactionID(tid).WithUUID(model.UUID).WithError(err).Errorf("%v - Could not marshal the combined message for the webhooks", tid)
+		return
+	}
+	d := webhookDelivery{
+		tid:  tid,
+		uuid: model.UUID,
+		headers: map[string]string{
+			"X-Request-Id":      tid,
+			"Origin-System-Id":  headers["Origin-System-Id"],
+			"Message-Type":      CombinerMessageType,
+			SchemaVersionHeader: model.SchemaVersion,
+			MessageKeyHeader:    model.UUID,
+		},
+		body: body,
+	}
+
+	contentType, _ := model.contentType()
+	for _, s := range w.subs {
+		if !s.accepts(contentType, headers["Origin-System-Id"]) {
+			continue
+		}
+		select {
+		case s.queue <- d:
+		default:
+			s.Lock()
+			s.status.Dropped++
+			s.Unlock()
+			logger.WithTransactionID(tid).WithUUID(model.UUID).Warnf("%v - Webhook queue of %v is full, the message was dropped", tid, s.Name)
+		}
+	}
+}
+
+// Status reports the deliveries of every subscriber.
+func (w *Webhooks) Status() []SubscriberStatus {
+	statuses := make([]SubscriberStatus, 0, len(w.subs))
+	for _, s := range w.subs {
+		s.Lock()
+		status := s.status
+		s.Unlock()
+		status.Pending = len(s.queue)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (s *subscription) accepts(contentType string, origin string) bool {
+	if len(s.ContentTypes) > 0 && !contains(s.ContentTypes, contentType) {
+		return false
+	}
+	return len(s.Origins) == 0 || contains(s.Origins, origin)
+}
+
+func (w *Webhooks) deliverAll(s *subscription) {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case d := <-s.queue:
+			w.deliver(s, d)
+		}
+	}
+}
+
+// deliver posts the message until it's accepted, the attempts are exhausted, or the subscriber rejects it.
+func (w *Webhooks) deliver(s *subscription, d webhookDelivery) {
+	backoff := w.Backoff
+	for attempt := 1; ; attempt++ {
+		status, err := s.post(d)
+		now := time.Now()
+		s.Lock()
+		s.status.LastStatusCode = status
+		if err == nil {
+			s.status.Delivered++
+			s.status.LastDelivery = &now
+			s.Unlock()
+			return
+		}
+		s.status.LastError = err.Error()
+		s.status.LastFailure = &now
+		if IsPermanentError(err) || attempt >= w.MaxAttempts {
+			s.status.Failed++
+			s.Unlock()
+			logger.WithTransactionID(d.tid).WithUUID(d.uuid).WithError(err).Errorf("%v - Webhook delivery to %v failed after %d attempts", d.tid, s.Name, attempt)
+			return
+		}
+		s.Unlock()
+
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post signs the delivery when the subscriber has a secret.
+func (s *subscription) post(d webhookDelivery) (int, error) {
+	headers := make(map[string]string, len(d.headers)+3)
+	for k, v := range d.headers {
+		headers[k] = v
+	}
+	headers["Content-Type"] = ContentType
+	if s.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		headers[WebhookTimestampHeader] = timestamp
+		headers[WebhookSignatureHeader] = WebhookSignature(s.Secret, timestamp, d.body)
+	}
+	return s.sink.post(d.uuid, producer.Message{Headers: headers, Body: string(d.body)})
+}
+
+// WebhookSignature is the HMAC-SHA256 of the timestamp and the body, joined by a dot, which subscribers compute to verify the deliveries.
+func WebhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
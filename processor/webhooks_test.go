@@ -0,0 +1,175 @@
+package processor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSubscribers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhooks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subscribers.json")
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"name":"search","url":"http://localhost/hook","contentTypes":["Article"],"secret":"s3cret"}]`), 0644))
+	subscribers, err := LoadSubscribers(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Subscriber{{Name: "search", URL: "http://localhost/hook", ContentTypes: []string{"Article"}, Secret: "s3cret"}}, subscribers)
+
+	for _, invalid := range []string{
+		`not json`,
+		`[{"url":"http://localhost/hook"}]`,
+		`[{"name":"a","url":"http://localhost/hook"},{"name":"a","url":"http://localhost/other"}]`,
+		`[{"name":"a","url":"localhost/hook"}]`,
+	} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(invalid), 0644))
+		_, err := LoadSubscribers(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestWebhooks_DeliversSignedMessages(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	webhooks := NewWebhooks([]Subscriber{
+		{Name: "articles", URL: server.URL, ContentTypes: []string{"Article"}, Secret: "s3cret"},
+		{Name: "videos", URL: server.URL, ContentTypes: []string{"Video"}},
+	}, server.Client())
+	webhooks.Start()
+	defer webhooks.Stop()
+
+	model := &CombinedModel{SchemaVersion: CombinedSchemaVersion, UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	webhooks.Notify(map[string]string{"X-Request-Id": "some-tid1", "Origin-System-Id": "some-origin"}, model)
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("the message wasn't delivered")
+	}
+	assert.Equal(t, "some-tid1", r.Header.Get("X-Request-Id"))
+	assert.Equal(t, "some_uuid", r.Header.Get(MessageKeyHeader))
+	assert.Equal(t, ContentType, r.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), `"uuid":"some_uuid"`)
+	assert.Equal(t, WebhookSignature("s3cret", r.Header.Get(WebhookTimestampHeader), body), r.Header.Get(WebhookSignatureHeader))
+
+	assert.Eventually(t, func() bool { return webhooks.Status()[0].Delivered == 1 }, time.Second, 5*time.Millisecond)
+	statuses := webhooks.Status()
+	assert.Equal(t, http.StatusOK, statuses[0].LastStatusCode)
+	assert.NotNil(t, statuses[0].LastDelivery)
+	assert.Equal(t, SubscriberStatus{Name: "videos", URL: server.URL}, statuses[1])
+}
+
+func TestWebhooks_RetriesFailedDeliveries(t *testing.T) {
+	var lock sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	webhooks := NewWebhooks([]Subscriber{{Name: "search", URL: server.URL, Origins: []string{"some-origin"}}}, server.Client())
+	webhooks.Backoff = time.Millisecond
+	webhooks.Start()
+	defer webhooks.Stop()
+
+	webhooks.Notify(map[string]string{"Origin-System-Id": "other-origin"}, &CombinedModel{UUID: "some_uuid"})
+	webhooks.Notify(map[string]string{"Origin-System-Id": "some-origin"}, &CombinedModel{UUID: "some_uuid"})
+
+	assert.Eventually(t, func() bool { return webhooks.Status()[0].Delivered == 1 }, time.Second, 5*time.Millisecond)
+	lock.Lock()
+	assert.Equal(t, 3, attempts)
+	lock.Unlock()
+	status := webhooks.Status()[0]
+	assert.Equal(t, int64(0), status.Failed)
+	assert.Contains(t, status.LastError, "503")
+}
+
+func TestWebhooks_GivesUpOnRejectedDeliveries(t *testing.T) {
+	var lock sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	webhooks := NewWebhooks([]Subscriber{{Name: "search", URL: server.URL}}, server.Client())
+	webhooks.Backoff = time.Millisecond
+	webhooks.Start()
+	defer webhooks.Stop()
+
+	webhooks.Notify(map[string]string{}, &CombinedModel{UUID: "some_uuid"})
+
+	assert.Eventually(t, func() bool { return webhooks.Status()[0].Failed == 1 }, time.Second, 5*time.Millisecond)
+	lock.Lock()
+	assert.Equal(t, 1, attempts)
+	lock.Unlock()
+	assert.Equal(t, http.StatusBadRequest, webhooks.Status()[0].LastStatusCode)
+}
+
+func TestWebhooks_DropsMessagesWhenTheQueueIsFull(t *testing.T) {
+	webhooks := NewWebhooks([]Subscriber{{Name: "search", URL: "http://localhost/hook"}}, http.DefaultClient)
+
+	for i := 0; i <= webhookQueueSize; i++ {
+		webhooks.Notify(map[string]string{}, &CombinedModel{UUID: "some_uuid"})
+	}
+
+	status := webhooks.Status()[0]
+	assert.Equal(t, webhookQueueSize, status.Pending)
+	assert.Equal(t, int64(1), status.Dropped)
+}
+
+func TestForwarder_NotifiesWebhooksOfForwardedMessages(t *testing.T) {
+	webhooks := NewWebhooks([]Subscriber{{Name: "search", URL: "http://localhost/hook"}}, http.DefaultClient)
+	f := NewForwarder(&RecordingMsgProducer{}, []string{"Article"})
+	f.Webhooks = webhooks
+
+	video := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Video"}}
+	assert.Equal(t, InvalidContentTypeError, f.filterAndForwardMsg(map[string]string{"X-Request-Id": "some-tid1"}, &video, "some-tid1"))
+	assert.Equal(t, 0, webhooks.Status()[0].Pending)
+
+	article := CombinedModel{UUID: "some_uuid", LastModified: "2017-03-30T13:09:06.48Z", MarkedDeleted: "false", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	assert.NoError(t, f.filterAndForwardMsg(map[string]string{"X-Request-Id": "some-tid2"}, &article, "some-tid2"))
+	assert.Equal(t, 1, webhooks.Status()[0].Pending)
+}
+
+func TestWebhooks_RedactsTheCredentialsOfTheSubscribers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	webhooks := NewWebhooks([]Subscriber{{Name: "search", URL: server.URL + "/hook?token=s3cret"}}, server.Client())
+	webhooks.MaxAttempts = 1
+	webhooks.Start()
+	defer webhooks.Stop()
+
+	webhooks.Notify(map[string]string{}, &CombinedModel{UUID: "some_uuid"})
+
+	assert.Eventually(t, func() bool { return webhooks.Status()[0].Failed == 1 }, time.Second, 5*time.Millisecond)
+	status := webhooks.Status()[0]
+	assert.Equal(t, server.URL+"/hook?token=REDACTED", status.URL)
+	assert.NotContains(t, status.LastError, "s3cret")
+}
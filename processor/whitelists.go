@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/dchest/uniuri"
+)
+
+const DefaultWhitelistsPollInterval = 10 * time.Second
+
+// Whitelist selects what the combiner processes: the content by contentUri, the annotations by Origin-System-Id,
+// and the combined messages forwarded by content type.
+type Whitelist struct {
+	ContentURIs  []string `json:"contentURIs"`
+	Origins      []string `json:"originSystemIds"`
+	ContentTypes []string `json:"contentTypes"`
+}
+
+func (w Whitelist) Validate() error {
+	if len(w.ContentURIs) == 0 || len(w.Origins) == 0 || len(w.ContentTypes) == 0 {
+		return errors.New("the contentURIs, originSystemIds and contentTypes whitelists must not be empty")
+	}
+	return nil
+}
+
+// ParseWhitelist reads a JSON whitelist, rejecting the unknown fields so that misspelt whitelists aren't silently ignored.
+func ParseWhitelist(b []byte) (Whitelist, error) {
+	var w Whitelist
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&w); err != nil {
+		return w, fmt.Errorf("could not parse the whitelists: %v", err)
+	}
+	return w, w.Validate()
+}
+
+// Whitelists holds the whitelist shared by the processors and their forwarders, so that replacing it applies to all of them at once.
+// It's replaced when the file at path changes, which is checked every PollInterval, or through Update. Every change is logged.
+type Whitelists struct {
+	sync.Mutex
+	PollInterval time.Duration
+	current      Whitelist
+	path         string
+	modTime      time.Time
+	stop         chan struct{}
+}
+
+// NewWhitelists starts from the whitelist in the file at path when there is one, from initial otherwise.
+func NewWhitelists(initial Whitelist, path string) (*Whitelists, error) {
+	if err := initial.Validate(); err != nil {
+		return nil, err
+	}
+	w := &Whitelists{PollInterval: DefaultWhitelistsPollInterval, current: initial, path: path, stop: make(chan struct{})}
+	if path == "" {
+		return w, nil
+	}
+	if err := w.reload(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Whitelists) Get() Whitelist {
+	w.Lock()
+	defer w.Unlock()
+	return w.current
+}
+
+// Update replaces the whitelist, and saves it to the file when there is one, so that the file isn't reloaded over it.
+// The change is logged as made by source, with the extra fields.
+func (w *Whitelists) Update(wl Whitelist, source string, fields map[string]interface{}, tid string) error {
+	if err := wl.Validate(); err != nil {
+		return err
+	}
+	w.Lock()
+	defer w.Unlock()
+	if w.path != "" {
+		b, err := json.MarshalIndent(wl, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomically(w.path, b); err != nil {
+			return fmt.Errorf("could not save the whitelists: %v", err)
+		}
+		if info, err := os.Stat(w.path); err == nil {
+			w.modTime = info.ModTime()
+		}
+	}
+	w.replace(wl, source, fields, tid)
+	return nil
+}
+
+func (w *Whitelists) replace(wl Whitelist, source string, fields map[string]interface{}, tid string) {
+	changes := whitelistChanges(w.current, wl)
+	w.current = wl
+	if len(changes) == 0 {
+		return
+	}
+	logger.WithTransactionID(tid).WithFields(fields).Infof("%v - Whitelists updated by %v: %v", tid, source, strings.Join(changes, "; "))
+}
+
+// Start reloads the file whenever it changes, until Stop is called.
+func (w *Whitelists) Start() {
+	if w.path == "" {
+		return
+	}
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.reload(); err != nil {
+				logger.WithError(err).Errorf("Could not reload the whitelists from %v, the current ones are kept", w.path)
+			}
+		}
+	}
+}
+
+func (w *Whitelists) Stop() {
+	close(w.stop)
+}
+
+func (w *Whitelists) reload() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	w.Lock()
+	defer w.Unlock()
+	if info.ModTime().Equal(w.modTime) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	wl, err := ParseWhitelist(b)
+	if err != nil {
+		return err
+	}
+	w.modTime = info.ModTime()
+	w.replace(wl, "file "+w.path, nil, "tid_whitelists_"+uniuri.NewLen(10)+"_post_publication_combiner")
+	return nil
+}
+
+func whitelistChanges(old Whitelist, new Whitelist) []string {
+	var changes []string
+	for _, l := range []struct {
+		name     string
+		old, new []string
+	}{
+		{"contentURIs", old.ContentURIs, new.ContentURIs},
+		{"originSystemIds", old.Origins, new.Origins},
+		{"contentTypes", old.ContentTypes, new.ContentTypes},
+	} {
+		added, removed := difference(l.new, l.old), difference(l.old, l.new)
+		if len(added) > 0 {
+			changes = append(changes, fmt.Sprintf("%v added %q", l.name, added))
+		}
+		if len(removed) > 0 {
+			changes = append(changes, fmt.Sprintf("%v removed %q", l.name, removed))
+		}
+	}
+	return changes
+}
+
+// difference returns the elements of a missing from b.
+func difference(a []string, b []string) []string {
+	var missing []string
+	for _, e := range a {
+		if !contains(b, e) {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testWhitelist = Whitelist{
+	ContentURIs:  []string{"wordpress-article-mapper"},
+	Origins:      []string{"http://cmdb.ft.com/systems/pac"},
+	ContentTypes: []string{"Article"},
+}
+
+func TestParseWhitelist(t *testing.T) {
+	w, err := ParseWhitelist([]byte(`{"contentURIs":["next-video-mapper"],"originSystemIds":["http://cmdb.ft.com/systems/pac"],"contentTypes":["Video"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"next-video-mapper"}, w.ContentURIs)
+	assert.Equal(t, []string{"Video"}, w.ContentTypes)
+
+	_, err = ParseWhitelist([]byte(`{"contentURIs":["next-video-mapper"],"originSystemIds":["http://cmdb.ft.com/systems/pac"],"contentType":["Video"]}`))
+	assert.Error(t, err)
+
+	_, err = ParseWhitelist([]byte(`{"contentURIs":[],"originSystemIds":["http://cmdb.ft.com/systems/pac"],"contentTypes":["Video"]}`))
+	assert.Error(t, err)
+}
+
+func TestWhitelists_UpdateAppliesToTheProcessorAndItsForwarder(t *testing.T) {
+	w, err := NewWhitelists(testWhitelist, "")
+	assert.NoError(t, err)
+	p := NewMsgProcessor(nil, MsgProcessorConfig{SupportedContentURIs: []string{"ignored-mapper"}}, DummyDataCombiner{}, nil, []string{"Audio"})
+	p.Whitelists = w
+	p.Forwarder.Whitelists = w
+	assert.Equal(t, testWhitelist, p.whitelist())
+	assert.Equal(t, []string{"Article"}, p.Forwarder.supportedContentTypes())
+
+	updated := Whitelist{
+		ContentURIs:  []string{"wordpress-article-mapper", "next-video-mapper"},
+		Origins:      []string{"http://cmdb.ft.com/systems/pac"},
+		ContentTypes: []string{"Article", "Video"},
+	}
+	assert.NoError(t, w.Update(updated, "test", nil, "tid_test"))
+	assert.Equal(t, updated, p.whitelist())
+	assert.Equal(t, []string{"Article", "Video"}, p.Forwarder.supportedContentTypes())
+
+	assert.Error(t, w.Update(Whitelist{}, "test", nil, "tid_test"))
+	assert.Equal(t, updated, w.Get())
+}
+
+func TestWhitelists_ReloadsTheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whitelists")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "whitelists.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"contentURIs":["next-video-mapper"],"originSystemIds":["http://cmdb.ft.com/systems/pac"],"contentTypes":["Video"]}`), 0644))
+
+	w, err := NewWhitelists(testWhitelist, path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"next-video-mapper"}, w.Get().ContentURIs)
+
+	// invalid whitelists are not applied
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"contentURIs":["next-video-mapper"]}`), 0644))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	assert.Error(t, w.reload())
+	assert.Equal(t, []string{"next-video-mapper"}, w.Get().ContentURIs)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"contentURIs":["upp-content-validator"],"originSystemIds":["http://cmdb.ft.com/systems/pac"],"contentTypes":["Article"]}`), 0644))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	assert.NoError(t, w.reload())
+	assert.Equal(t, []string{"upp-content-validator"}, w.Get().ContentURIs)
+
+	// updates are saved to the file, so that they aren't reloaded over
+	assert.NoError(t, w.Update(testWhitelist, "test", nil, "tid_test"))
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	saved, err := ParseWhitelist(b)
+	assert.NoError(t, err)
+	assert.Equal(t, testWhitelist, saved)
+	assert.NoError(t, w.reload())
+	assert.Equal(t, testWhitelist, w.Get())
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// PriorityLimiter shares a number of concurrent requests between high and low priority clients.
+// Low priority requests are limited to lowCapacity of them, and wait as long as high priority requests are waiting,
+// so that the high priority requests get the connections first.
+type PriorityLimiter struct {
+	sync.Mutex
+	cond        *sync.Cond
+	capacity    int
+	lowCapacity int
+	inUse       int
+	lowInUse    int
+	highWaiting int
+}
+
+// NewPriorityLimiter allows at least one request of each priority at once, and no more low priority requests than the capacity.
+func NewPriorityLimiter(capacity int, lowCapacity int) *PriorityLimiter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if lowCapacity < 1 {
+		lowCapacity = 1
+	}
+	if lowCapacity > capacity {
+		lowCapacity = capacity
+	}
+	l := &PriorityLimiter{capacity: capacity, lowCapacity: lowCapacity}
+	l.cond = sync.NewCond(l)
+	return l
+}
+
+// High returns a client whose requests go first.
+func (l *PriorityLimiter) High(c Client) Client {
+	return &priorityClient{client: c, limiter: l, high: true}
+}
+
+// Low returns a client whose requests wait for the high priority ones.
+func (l *PriorityLimiter) Low(c Client) Client {
+	return &priorityClient{client: c, limiter: l}
+}
+
+func (l *PriorityLimiter) acquire(high bool) {
+	l.Lock()
+	defer l.Unlock()
+	if high {
+		l.highWaiting++
+		for l.inUse >= l.capacity {
+			l.cond.Wait()
+		}
+		l.highWaiting--
+	} else {
+		for l.inUse >= l.capacity || l.lowInUse >= l.lowCapacity || l.highWaiting > 0 {
+			l.cond.Wait()
+		}
+		l.lowInUse++
+	}
+	l.inUse++
+}
+
+func (l *PriorityLimiter) release(high bool) {
+	l.Lock()
+	defer l.Unlock()
+	l.inUse--
+	if !high {
+		l.lowInUse--
+	}
+	l.cond.Broadcast()
+}
+
+type priorityClient struct {
+	client  Client
+	limiter *PriorityLimiter
+	high    bool
+}
+
+// Do holds its share of the limiter until the response body is closed.
+func (c *priorityClient) Do(req *http.Request) (*http.Response, error) {
+	c.limiter.acquire(c.high)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.limiter.release(c.high)
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { c.limiter.release(c.high) }}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type blockingClient struct {
+	sync.Mutex
+	order   []string
+	started chan string
+	proceed chan struct{}
+}
+
+func (c *blockingClient) Do(req *http.Request) (*http.Response, error) {
+	c.started <- req.URL.Path
+	<-c.proceed
+	c.Lock()
+	c.order = append(c.order, req.URL.Path)
+	c.Unlock()
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+}
+
+func TestPriorityLimiter_HighPriorityRequestsGoFirst(t *testing.T) {
+	c := &blockingClient{started: make(chan string, 10), proceed: make(chan struct{})}
+	l := NewPriorityLimiter(1, 1)
+	high, low := l.High(c), l.Low(c)
+
+	do := func(client Client, path string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go do(low, "/forced1", &wg)
+	assert.Equal(t, "/forced1", <-c.started)
+
+	// while the first request holds the only connection, both a forced and a live request wait for it
+	go do(low, "/forced2", &wg)
+	time.Sleep(50 * time.Millisecond)
+	go do(high, "/live", &wg)
+	time.Sleep(50 * time.Millisecond)
+
+	c.proceed <- struct{}{}
+	assert.Equal(t, "/live", <-c.started)
+	c.proceed <- struct{}{}
+	assert.Equal(t, "/forced2", <-c.started)
+	c.proceed <- struct{}{}
+	wg.Wait()
+
+	assert.Equal(t, []string{"/forced1", "/live", "/forced2"}, c.order)
+}
+
+func TestPriorityLimiter_LimitsLowPriorityRequests(t *testing.T) {
+	c := &blockingClient{started: make(chan string, 10), proceed: make(chan struct{})}
+	l := NewPriorityLimiter(3, 1)
+	high, low := l.High(c), l.Low(c)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for _, r := range []struct {
+		client Client
+		path   string
+	}{{low, "/forced1"}, {low, "/forced2"}, {high, "/live"}} {
+		go func(client Client, path string) {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+			resp, err := client.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+		}(r.client, r.path)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// only one of the forced requests is made at once, the live request doesn't wait for it
+	assert.Equal(t, "/forced1", <-c.started)
+	assert.Equal(t, "/live", <-c.started)
+	select {
+	case path := <-c.started:
+		t.Errorf("unexpected request %v", path)
+	default:
+	}
+	for i := 0; i < 3; i++ {
+		c.proceed <- struct{}{}
+	}
+	wg.Wait()
+	assert.Len(t, c.order, 3)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+)
+
+// whitelistsHandler shows and replaces the whitelists. It's routed for the callers with the admin API key only.
+type whitelistsHandler struct {
+	whitelists *processor.Whitelists
+}
+
+func (handler *whitelistsHandler) getWhitelists(writer http.ResponseWriter, request *http.Request) {
+	handler.writeWhitelists(writer)
+}
+
+func (handler *whitelistsHandler) putWhitelists(writer http.ResponseWriter, request *http.Request) {
+	tid := request.Header.Get("X-Request-Id")
+	b, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	wl, err := processor.ParseWhitelist(b)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	audit := map[string]interface{}{"remoteAddr": request.RemoteAddr}
+	if err := handler.whitelists.Update(wl, "admin endpoint call by "+callerOf(request), audit, tid); err != nil {
+		logger.WithTransactionID(tid).WithError(err).Errorf("%v - Could not update the whitelists", tid)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	handler.writeWhitelists(writer)
+}
+
+func (handler *whitelistsHandler) writeWhitelists(writer http.ResponseWriter) {
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(handler.whitelists.Get()); err != nil {
+		logger.WithError(err).Error("Could not write the whitelists")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	testLogger "github.com/Financial-Times/go-logger/test"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhitelistsEndpoint(t *testing.T) {
+	whitelists, err := processor.NewWhitelists(processor.Whitelist{
+		ContentURIs:  []string{"wordpress-article-mapper"},
+		Origins:      []string{"http://cmdb.ft.com/systems/pac"},
+		ContentTypes: []string{"Article"},
+	}, "")
+	assert.NoError(t, err)
+	wh := whitelistsHandler{whitelists: whitelists}
+	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/__whitelists", adminOnly(wh.getWhitelists)).Methods("GET")
+	servicesRouter.HandleFunc("/__whitelists", adminOnly(wh.putWhitelists)).Methods("PUT")
+
+	w := httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, httptest.NewRequest("GET", "/__whitelists", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", "/__whitelists", nil)
+	req.Header.Set("Authorization", "Bearer some-key")
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"contentURIs":["wordpress-article-mapper"],"originSystemIds":["http://cmdb.ft.com/systems/pac"],"contentTypes":["Article"]}`, w.Body.String())
+
+	updated := `{"contentURIs":["wordpress-article-mapper","next-video-mapper"],"originSystemIds":["http://cmdb.ft.com/systems/pac"],"contentTypes":["Article","Video"]}`
+	req = httptest.NewRequest("PUT", "/__whitelists", strings.NewReader(updated))
+	req.Header.Set("Authorization", "Bearer other-key")
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, []string{"Article"}, whitelists.Get().ContentTypes)
+
+	hook := testLogger.NewTestHook("whitelists")
+	req = httptest.NewRequest("PUT", "/__whitelists", strings.NewReader(updated))
+	req.Header.Set("Authorization", "Bearer some-key")
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, updated, w.Body.String())
+	assert.Equal(t, []string{"Article", "Video"}, whitelists.Get().ContentTypes)
+	assert.Contains(t, hook.LastEntry().Message, "Whitelists updated by admin endpoint call by "+AdminCaller)
+	assert.Equal(t, req.RemoteAddr, hook.LastEntry().Data["remoteAddr"])
+
+	req = httptest.NewRequest("PUT", "/__whitelists", strings.NewReader(`{"contentURIs":[]}`))
+	req.Header.Set("Authorization", "Bearer some-key")
+	w = httptest.NewRecorder()
+	servicesRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWhitelistsEndpointWithoutAPIKey(t *testing.T) {
+	whitelists, err := processor.NewWhitelists(processor.Whitelist{
+		ContentURIs:  []string{"wordpress-article-mapper"},
+		Origins:      []string{"http://cmdb.ft.com/systems/pac"},
+		ContentTypes: []string{"Article"},
+	}, "")
+	assert.NoError(t, err)
+	wh := whitelistsHandler{whitelists: whitelists}
+
+	req := httptest.NewRequest("GET", "/__whitelists", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	requireCaller(withAdminKey("", nil), requireAdmin(wh.getWhitelists))(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}